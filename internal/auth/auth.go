@@ -9,71 +9,27 @@ import (
 	"strings"
 	"time"
 
-	"github.com/alexedwards/argon2id"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-func HashPassword(password string) (string, error) {
-	hashedPwd, err := argon2id.CreateHash(password, argon2id.DefaultParams)
-	if err != nil {
-		fmt.Println(err)
-		return "", err
-	}
-	return hashedPwd, nil
-}
-
-func CheckPasswordHash(password, hash string) (bool, error) {
-	matched, err := argon2id.ComparePasswordAndHash(password, hash)
-	if err != nil {
-		fmt.Println(err)
-		return false, err
-	}
-	return matched, nil
-}
-
+// MakeJWT signs with a single HS256 secret. Servers with asymmetric keys use
+// KeySet.MakeJWT instead.
 func MakeJWT(userId uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userId.String(),
-	})
-
-	tokenString, err := token.SignedString([]byte(tokenSecret))
+	ks, err := NewKeySet("", NewHMACKey("", []byte(tokenSecret)))
 	if err != nil {
-		fmt.Println(err)
 		return "", err
 	}
 
-	return tokenString, nil
+	return ks.MakeJWT(userId, expiresIn)
 }
 
-func ValidateJWT(tonkenstring, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tonkenstring, &jwt.RegisteredClaims{}, func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return []byte(tokenSecret), nil
-	})
-
-	if err != nil {
-		fmt.Println(err)
-		return uuid.UUID{}, err
-	}
-
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok || !token.Valid {
-		return uuid.UUID{}, fmt.Errorf("invalid token")
-	}
-
-	userId, err := uuid.Parse(claims.Subject)
+func ValidateJWT(tonkenstring, tokenSecret string, opts ...ValidateOption) (uuid.UUID, error) {
+	ks, err := NewKeySet("", NewHMACKey("", []byte(tokenSecret)))
 	if err != nil {
-		fmt.Println(err)
 		return uuid.UUID{}, err
 	}
 
-	return userId, nil
+	return ks.ValidateJWT(tonkenstring, opts...)
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -91,6 +47,24 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(key), nil
 }
 
+// PersonalAccessTokenPrefix marks opaque API tokens so they can share the
+// Bearer scheme with JWTs and still be told apart without a database lookup.
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+func MakePersonalAccessToken() (string, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+
+	return PersonalAccessTokenPrefix + hex.EncodeToString(key), nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
 func extractAuthToken(headers http.Header, scheme string) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
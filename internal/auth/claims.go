@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	Issuer   = "chirpy"
+	Audience = "chirpy-api"
+
+	TokenTypeAccess = "access"
+
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+
+	ScopeChirpsRead  = "chirps:read"
+	ScopeChirpsWrite = "chirps:write"
+	ScopeAccount     = "account"
+)
+
+// DefaultScopes are granted to tokens issued by a login, which can do
+// everything the user can.
+var DefaultScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeAccount}
+
+var (
+	ErrInsufficientScope = errors.New("token is missing a required scope")
+	ErrInsufficientRole  = errors.New("token does not have the required role")
+)
+
+// Claims are the claims Chirpy puts in its tokens. Scope is a space separated
+// list as in RFC 8693. SessionID is the refresh token family the token was
+// issued for, so a request can be tied to the session that made it.
+type Claims struct {
+	jwt.RegisteredClaims
+	TokenType string `json:"typ"`
+	Scope     string `json:"scope,omitempty"`
+	Role      string `json:"role,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+}
+
+// NewAccessClaims builds the claims for an access token. Every token gets its
+// own jti so it can be told apart in logs.
+func NewAccessClaims(userId uuid.UUID, role string, scopes []string, expiresIn time.Duration) *Claims {
+	now := time.Now().UTC()
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    Issuer,
+			Subject:   userId.String(),
+			Audience:  jwt.ClaimStrings{Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			ID:        uuid.NewString(),
+		},
+		TokenType: TokenTypeAccess,
+		Scope:     strings.Join(scopes, " "),
+		Role:      role,
+	}
+}
+
+func (c *Claims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+}
+
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes(), scope)
+}
+
+type validateOptions struct {
+	audience  string
+	tokenType string
+	scopes    []string
+	role      string
+}
+
+// ValidateOption adds a requirement on top of the signature and expiry checks.
+// By default a token must be an access token for the Chirpy API.
+type ValidateOption func(*validateOptions)
+
+func WithAudience(audience string) ValidateOption {
+	return func(o *validateOptions) {
+		o.audience = audience
+	}
+}
+
+func WithTokenType(tokenType string) ValidateOption {
+	return func(o *validateOptions) {
+		o.tokenType = tokenType
+	}
+}
+
+// WithScopes requires every listed scope to be present.
+func WithScopes(scopes ...string) ValidateOption {
+	return func(o *validateOptions) {
+		o.scopes = append(o.scopes, scopes...)
+	}
+}
+
+func WithRole(role string) ValidateOption {
+	return func(o *validateOptions) {
+		o.role = role
+	}
+}
+
+func newValidateOptions(opts []ValidateOption) validateOptions {
+	o := validateOptions{
+		audience:  Audience,
+		tokenType: TokenTypeAccess,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// check covers what the jwt parser does not: token type, scopes and role.
+func (o validateOptions) check(c *Claims) error {
+	if c.TokenType != o.tokenType {
+		return errors.New("unexpected token type")
+	}
+
+	for _, scope := range o.scopes {
+		if !c.HasScope(scope) {
+			return ErrInsufficientScope
+		}
+	}
+
+	if o.role != "" && c.Role != o.role {
+		return ErrInsufficientRole
+	}
+
+	return nil
+}
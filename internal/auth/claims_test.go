@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestValidateOptions checks the audience, token type, scope and role
+// requirements that ParseJWT applies on top of the signature.
+func TestValidateOptions(t *testing.T) {
+	ks, err := NewKeySet("", NewHMACKey("", []byte("a-very-secure-secret-key")))
+	if err != nil {
+		t.Fatalf("NewKeySet() returned an unexpected error: %v", err)
+	}
+
+	userId := uuid.New()
+	readOnly, err := ks.Sign(NewAccessClaims(userId, RoleUser, []string{ScopeChirpsRead}, time.Hour))
+	if err != nil {
+		t.Fatalf("Sign() returned an unexpected error: %v", err)
+	}
+
+	claims, err := ks.ParseJWT(readOnly)
+	if err != nil {
+		t.Fatalf("ParseJWT() returned an unexpected error: %v", err)
+	}
+	if claims.ID == "" {
+		t.Error("expected the token to have a jti")
+	}
+	if claims.Role != RoleUser || !claims.HasScope(ScopeChirpsRead) {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	if _, err := ks.ValidateJWT(readOnly, WithScopes(ScopeChirpsRead)); err != nil {
+		t.Errorf("expected the read scope to be accepted, got: %v", err)
+	}
+	if _, err := ks.ValidateJWT(readOnly, WithScopes(ScopeChirpsWrite)); !errors.Is(err, ErrInsufficientScope) {
+		t.Errorf("expected ErrInsufficientScope, got: %v", err)
+	}
+	if _, err := ks.ValidateJWT(readOnly, WithRole(RoleAdmin)); !errors.Is(err, ErrInsufficientRole) {
+		t.Errorf("expected ErrInsufficientRole, got: %v", err)
+	}
+	if _, err := ks.ValidateJWT(readOnly, WithAudience("another-service")); err == nil {
+		t.Error("expected a token for a different audience to be rejected")
+	}
+	if _, err := ks.ValidateJWT(readOnly, WithTokenType("mfa")); err == nil {
+		t.Error("expected an access token to be rejected where another type is required")
+	}
+}
+
+// TestPrincipalSession checks that the session a token was issued for
+// survives signing and parsing, and that tokens without one stay valid.
+func TestPrincipalSession(t *testing.T) {
+	ks, err := NewKeySet("", NewHMACKey("", []byte("a-very-secure-secret-key")))
+	if err != nil {
+		t.Fatalf("NewKeySet() returned an unexpected error: %v", err)
+	}
+
+	userId := uuid.New()
+	sessionId := uuid.New()
+
+	claims := NewAccessClaims(userId, RoleUser, DefaultScopes, time.Hour)
+	claims.SessionID = sessionId.String()
+	token, err := ks.Sign(claims)
+	if err != nil {
+		t.Fatalf("Sign() returned an unexpected error: %v", err)
+	}
+
+	parsed, err := ks.ParseJWT(token)
+	if err != nil {
+		t.Fatalf("ParseJWT() returned an unexpected error: %v", err)
+	}
+
+	principal, err := PrincipalFromClaims(parsed)
+	if err != nil {
+		t.Fatalf("PrincipalFromClaims() returned an unexpected error: %v", err)
+	}
+	if !principal.SessionID.Valid || principal.SessionID.UUID != sessionId {
+		t.Errorf("expected session %s, got %+v", sessionId, principal.SessionID)
+	}
+
+	principal, err = PrincipalFromClaims(NewAccessClaims(userId, RoleUser, DefaultScopes, time.Hour))
+	if err != nil {
+		t.Fatalf("PrincipalFromClaims() returned an unexpected error: %v", err)
+	}
+	if principal.SessionID.Valid {
+		t.Errorf("expected no session, got %s", principal.SessionID.UUID)
+	}
+
+	claims.SessionID = "not-a-uuid"
+	if _, err := PrincipalFromClaims(claims); err == nil {
+		t.Error("expected a malformed session id to be rejected")
+	}
+}
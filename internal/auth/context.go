@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// Principal is the authenticated caller of a request. SessionID is unset for
+// personal access tokens, which don't belong to a login session.
+type Principal struct {
+	UserID    uuid.UUID
+	Role      string
+	Scopes    []string
+	SessionID uuid.NullUUID
+}
+
+type principalKey struct{}
+
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the caller stored by the auth middleware, or
+// false for anonymous requests.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+func PrincipalFromClaims(c *Claims) (*Principal, error) {
+	userId, err := c.UserID()
+	if err != nil {
+		return nil, err
+	}
+
+	sessionId := uuid.NullUUID{}
+	if c.SessionID != "" {
+		sessionId.UUID, err = uuid.Parse(c.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		sessionId.Valid = true
+	}
+
+	return &Principal{
+		UserID:    userId,
+		Role:      c.Role,
+		Scopes:    c.Scopes(),
+		SessionID: sessionId,
+	}, nil
+}
+
+func (p *Principal) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(p.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,282 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Key is a single JWT signing or verification key. Keys loaded from a public
+// PEM can only verify, which is how retired keys stay around during rotation.
+type Key struct {
+	ID        string
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+	// notAfter, when set, is when the key stops verifying.
+	notAfter time.Time
+}
+
+// NewHMACKey wraps the legacy shared secret. HMAC keys are never published in
+// the JWKS since anyone holding them could mint tokens.
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{
+		ID:        id,
+		method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+// NewLegacyHMACKey accepts tokens signed with the old shared secret, and
+// carrying no kid, until the given time. It can never sign, so it only bridges
+// the switch to asymmetric keys for tokens that were already handed out.
+func NewLegacyHMACKey(secret []byte, until time.Time) *Key {
+	return &Key{
+		method:    jwt.SigningMethodHS256,
+		verifyKey: secret,
+		notAfter:  until,
+	}
+}
+
+// ParsePEMKey reads a PKCS#8 private key or a PKIX public key. Ed25519 keys
+// sign with EdDSA and RSA keys with RS256.
+func ParsePEMKey(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM block found", id)
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+
+		switch k := parsed.(type) {
+		case ed25519.PrivateKey:
+			return &Key{ID: id, method: jwt.SigningMethodEdDSA, signKey: k, verifyKey: k.Public()}, nil
+		case *rsa.PrivateKey:
+			return &Key{ID: id, method: jwt.SigningMethodRS256, signKey: k, verifyKey: &k.PublicKey}, nil
+		}
+		return nil, fmt.Errorf("key %s: unsupported private key type %T", id, parsed)
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+
+		switch k := parsed.(type) {
+		case ed25519.PublicKey:
+			return &Key{ID: id, method: jwt.SigningMethodEdDSA, verifyKey: k}, nil
+		case *rsa.PublicKey:
+			return &Key{ID: id, method: jwt.SigningMethodRS256, verifyKey: k}, nil
+		}
+		return nil, fmt.Errorf("key %s: unsupported public key type %T", id, parsed)
+	}
+
+	return nil, fmt.Errorf("key %s: unsupported PEM block %q", id, block.Type)
+}
+
+// LoadPEMKeys reads every *.pem file in dir. The file name without its
+// extension becomes the kid.
+func LoadPEMKeys(dir string) ([]*Key, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []*Key{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := ParsePEMKey(strings.TrimSuffix(filepath.Base(path), ".pem"), data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// KeySet signs with one active key and verifies with any key it holds, chosen
+// by the token's kid header.
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+func NewKeySet(activeID string, keys ...*Key) (*KeySet, error) {
+	ks := &KeySet{keys: map[string]*Key{}}
+	for _, key := range keys {
+		if _, ok := ks.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		ks.keys[key.ID] = key
+	}
+
+	active, ok := ks.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active key %q not found", activeID)
+	}
+	if active.signKey == nil {
+		return nil, fmt.Errorf("active key %q has no private key", activeID)
+	}
+	ks.active = active
+
+	return ks, nil
+}
+
+// MakeJWT issues a regular user access token with the default scopes.
+func (ks *KeySet) MakeJWT(userId uuid.UUID, expiresIn time.Duration) (string, error) {
+	return ks.Sign(NewAccessClaims(userId, RoleUser, DefaultScopes, expiresIn))
+}
+
+func (ks *KeySet) Sign(claims *Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.method, claims)
+	if ks.active.ID != "" {
+		token.Header["kid"] = ks.active.ID
+	}
+
+	tokenString, err := token.SignedString(ks.active.signKey)
+	if err != nil {
+		fmt.Println(err)
+		return "", err
+	}
+
+	return tokenString, nil
+}
+
+// ParseJWT verifies the signature, issuer, audience and expiry, then applies
+// the token type, scope and role requirements in opts.
+func (ks *KeySet) ParseJWT(tokenString string, opts ...ValidateOption) (*Claims, error) {
+	o := newValidateOptions(opts)
+
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, ks.keyFunc,
+		jwt.WithIssuer(Issuer),
+		jwt.WithAudience(o.audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	err = o.check(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (ks *KeySet) ValidateJWT(tokenString string, opts ...ValidateOption) (uuid.UUID, error) {
+	claims, err := ks.ParseJWT(tokenString, opts...)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	userId, err := claims.UserID()
+	if err != nil {
+		fmt.Println(err)
+		return uuid.UUID{}, err
+	}
+
+	return userId, nil
+}
+
+// keyFunc looks the key up by kid and refuses tokens whose alg does not match
+// it, so a public key can never be used as an HMAC secret.
+func (ks *KeySet) keyFunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %q", kid)
+	}
+
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+
+	if !key.notAfter.IsZero() && time.Now().After(key.notAfter) {
+		return nil, fmt.Errorf("signing key %q is no longer accepted", kid)
+	}
+
+	return key.verifyKey, nil
+}
+
+// JWK is the RFC 7517 public form of a key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public half of every asymmetric key, including retired keys
+// that only verify, so other services keep accepting tokens during rotation.
+func (ks *KeySet) JWKS() JWKS {
+	ids := slices.Sorted(maps.Keys(ks.keys))
+
+	set := JWKS{Keys: []JWK{}}
+	for _, id := range ids {
+		jwk, err := ks.keys[id].jwk()
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+func (k *Key) jwk() (JWK, error) {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.method.Alg()}
+
+	switch pub := k.verifyKey.(type) {
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	default:
+		return JWK{}, errors.New("key has no public form")
+	}
+
+	return jwk, nil
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func pemPrivateKey(t *testing.T, key any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal private key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func pemPublicKey(t *testing.T, key any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// TestKeySetAlgorithms signs and validates a token with each supported
+// asymmetric algorithm.
+func TestKeySetAlgorithms(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ed25519 key: %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %v", err)
+	}
+
+	testCases := []struct {
+		name string
+		key  any
+	}{
+		{name: "EdDSA", key: edKey},
+		{name: "RS256", key: rsaKey},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := ParsePEMKey("k1", pemPrivateKey(t, tc.key))
+			if err != nil {
+				t.Fatalf("ParsePEMKey() returned an unexpected error: %v", err)
+			}
+
+			ks, err := NewKeySet("k1", key)
+			if err != nil {
+				t.Fatalf("NewKeySet() returned an unexpected error: %v", err)
+			}
+
+			userId := uuid.New()
+			token, err := ks.MakeJWT(userId, time.Hour)
+			if err != nil {
+				t.Fatalf("MakeJWT() returned an unexpected error: %v", err)
+			}
+
+			validatedUserId, err := ks.ValidateJWT(token)
+			if err != nil {
+				t.Fatalf("ValidateJWT() returned an unexpected error: %v", err)
+			}
+			if validatedUserId != userId {
+				t.Errorf("expected user ID %v, but got %v", userId, validatedUserId)
+			}
+
+			jwks := ks.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != "k1" || jwks.Keys[0].Alg != tc.name {
+				t.Errorf("unexpected JWKS: %+v", jwks)
+			}
+		})
+	}
+}
+
+// TestKeySetRotation checks that tokens signed by a retired key still validate
+// while its public half is kept, and stop validating once it is removed.
+func TestKeySetRotation(t *testing.T) {
+	oldPub, oldPriv, _ := ed25519.GenerateKey(rand.Reader)
+	_, newPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	oldKey, err := ParsePEMKey("old", pemPrivateKey(t, oldPriv))
+	if err != nil {
+		t.Fatalf("ParsePEMKey() returned an unexpected error: %v", err)
+	}
+	before, err := NewKeySet("old", oldKey)
+	if err != nil {
+		t.Fatalf("NewKeySet() returned an unexpected error: %v", err)
+	}
+
+	userId := uuid.New()
+	oldToken, err := before.MakeJWT(userId, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() returned an unexpected error: %v", err)
+	}
+
+	newKey, err := ParsePEMKey("new", pemPrivateKey(t, newPriv))
+	if err != nil {
+		t.Fatalf("ParsePEMKey() returned an unexpected error: %v", err)
+	}
+	retiredKey, err := ParsePEMKey("old", pemPublicKey(t, oldPub))
+	if err != nil {
+		t.Fatalf("ParsePEMKey() returned an unexpected error: %v", err)
+	}
+
+	if _, err := NewKeySet("old", newKey, retiredKey); err == nil {
+		t.Error("expected a verification-only key to be rejected as the active key")
+	}
+
+	during, err := NewKeySet("new", newKey, retiredKey)
+	if err != nil {
+		t.Fatalf("NewKeySet() returned an unexpected error: %v", err)
+	}
+	if _, err := during.ValidateJWT(oldToken); err != nil {
+		t.Errorf("expected a token from the retired key to validate, got: %v", err)
+	}
+	if len(during.JWKS().Keys) != 2 {
+		t.Errorf("expected both keys in the JWKS, got %d", len(during.JWKS().Keys))
+	}
+
+	after, err := NewKeySet("new", newKey)
+	if err != nil {
+		t.Fatalf("NewKeySet() returned an unexpected error: %v", err)
+	}
+	if _, err := after.ValidateJWT(oldToken); err == nil {
+		t.Error("expected a token from a removed key to be rejected")
+	}
+}
+
+// TestKeySetAlgorithmConfusion makes sure an HS256 token cannot claim the kid
+// of an asymmetric key.
+func TestKeySetAlgorithmConfusion(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	key, err := ParsePEMKey("k1", pemPrivateKey(t, priv))
+	if err != nil {
+		t.Fatalf("ParsePEMKey() returned an unexpected error: %v", err)
+	}
+	ks, err := NewKeySet("k1", key)
+	if err != nil {
+		t.Fatalf("NewKeySet() returned an unexpected error: %v", err)
+	}
+
+	forger, err := NewKeySet("k1", NewHMACKey("k1", []byte("guessed-secret")))
+	if err != nil {
+		t.Fatalf("NewKeySet() returned an unexpected error: %v", err)
+	}
+	forged, err := forger.MakeJWT(uuid.New(), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() returned an unexpected error: %v", err)
+	}
+
+	if _, err := ks.ValidateJWT(forged); err == nil {
+		t.Error("expected an HS256 token to be rejected by an EdDSA key")
+	}
+	if len(forger.JWKS().Keys) != 0 {
+		t.Error("expected HMAC keys to be left out of the JWKS")
+	}
+}
+
+// TestLegacyHMACKey checks that tokens signed with the old shared secret are
+// only accepted until the opt-in runs out, and that the secret can't sign.
+func TestLegacyHMACKey(t *testing.T) {
+	secret := []byte("a-very-secure-secret-key")
+	legacy, err := NewKeySet("", NewHMACKey("", secret))
+	if err != nil {
+		t.Fatalf("NewKeySet() returned an unexpected error: %v", err)
+	}
+
+	legacyToken, err := legacy.MakeJWT(uuid.New(), time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() returned an unexpected error: %v", err)
+	}
+
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	key, err := ParsePEMKey("current", pemPrivateKey(t, priv))
+	if err != nil {
+		t.Fatalf("ParsePEMKey() returned an unexpected error: %v", err)
+	}
+
+	if _, err := NewKeySet("", key, NewLegacyHMACKey(secret, time.Now().Add(time.Hour))); err == nil {
+		t.Error("expected the legacy key to be rejected as the active key")
+	}
+
+	during, err := NewKeySet("current", key, NewLegacyHMACKey(secret, time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("NewKeySet() returned an unexpected error: %v", err)
+	}
+	if _, err := during.ValidateJWT(legacyToken); err != nil {
+		t.Errorf("expected a legacy token to validate during the opt-in, got: %v", err)
+	}
+
+	after, err := NewKeySet("current", key, NewLegacyHMACKey(secret, time.Now().Add(-time.Second)))
+	if err != nil {
+		t.Fatalf("NewKeySet() returned an unexpected error: %v", err)
+	}
+	if _, err := after.ValidateJWT(legacyToken); err == nil {
+		t.Error("expected a legacy token to be rejected once the opt-in ran out")
+	}
+}
@@ -0,0 +1,28 @@
+package auth
+
+import "time"
+
+// LockoutPolicy decides how long logins stay blocked after repeated failures.
+// Below Threshold nothing is locked; from there the lock starts at Base and
+// doubles with every further failure, up to Max.
+type LockoutPolicy struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+}
+
+func (p LockoutPolicy) Duration(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+
+	d := p.Base
+	for range failures - p.Threshold {
+		d *= 2
+		if d >= p.Max {
+			return p.Max
+		}
+	}
+
+	return min(d, p.Max)
+}
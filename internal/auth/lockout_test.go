@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicyDuration(t *testing.T) {
+	policy := LockoutPolicy{Threshold: 5, Base: 30 * time.Second, Max: time.Hour}
+
+	testCases := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{0, 0},
+		{4, 0},
+		{5, 30 * time.Second},
+		{6, time.Minute},
+		{7, 2 * time.Minute},
+		{12, time.Hour},
+		{1000, time.Hour},
+	}
+
+	for _, tc := range testCases {
+		if got := policy.Duration(tc.failures); got != tc.expected {
+			t.Errorf("after %d failures expected %v, but got %v", tc.failures, tc.expected, got)
+		}
+	}
+}
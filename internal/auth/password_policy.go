@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	ViolationTooShort     = "too_short"
+	ViolationTooLong      = "too_long"
+	ViolationTooWeak      = "too_weak"
+	ViolationPersonalInfo = "contains_personal_info"
+	ViolationBreached     = "breached"
+)
+
+// Shorter context words, like "bob" from bob@example.com, would turn down
+// too many unrelated passwords.
+const minContextWordLength = 4
+
+// PasswordViolation is one reason a password was turned down. Code is stable
+// for clients to match on, Message is meant for people.
+type PasswordViolation struct {
+	Code    string
+	Message string
+}
+
+// BreachChecker reports whether a password is known from a data breach.
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MinScore is the lowest PasswordScore accepted, from 0 to 4.
+	MinScore int
+	// Breaches is skipped when nil.
+	Breaches BreachChecker
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength: 8,
+	MaxLength: 128,
+	MinScore:  2,
+}
+
+// Check returns every way password breaks the policy, or none if it is
+// acceptable. context holds what is known about the user, such as their email
+// and handle; passwords built from it are turned down. The error is only set
+// when the breach lookup itself fails.
+func (p PasswordPolicy) Check(password string, context ...string) ([]PasswordViolation, error) {
+	violations := []PasswordViolation{}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    ViolationTooShort,
+			Message: fmt.Sprintf("password must be at least %d characters", p.MinLength),
+		})
+	}
+
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PasswordViolation{
+			Code:    ViolationTooLong,
+			Message: fmt.Sprintf("password cannot be longer than %d characters", p.MaxLength),
+		})
+		// Scoring and hashing a huge input is what the limit is there to
+		// avoid.
+		return violations, nil
+	}
+
+	words := contextWords(context)
+	lower := strings.ToLower(password)
+	for _, word := range words {
+		if strings.Contains(lower, word) {
+			violations = append(violations, PasswordViolation{
+				Code:    ViolationPersonalInfo,
+				Message: "password cannot contain your email or handle",
+			})
+			break
+		}
+	}
+
+	if PasswordScore(password, context...) < p.MinScore {
+		violations = append(violations, PasswordViolation{
+			Code:    ViolationTooWeak,
+			Message: "password is too easy to guess, try a longer one or a few unrelated words",
+		})
+	}
+
+	if p.Breaches != nil && length > 0 {
+		breached, err := p.Breaches.IsBreached(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			violations = append(violations, PasswordViolation{
+				Code:    ViolationBreached,
+				Message: "password has appeared in a data breach, choose another one",
+			})
+		}
+	}
+
+	return violations, nil
+}
+
+// PasswordScore rates how hard password is to guess from 0 to 4, on the same
+// scale as zxcvbn. It estimates the guesses needed by charging common words,
+// context words, repeats and runs like "abc" or "qwer" far less than random
+// characters.
+func PasswordScore(password string, context ...string) int {
+	bits := passwordEntropy(password, contextWords(context))
+
+	// Thresholds in bits for 10^3, 10^6, 10^8 and 10^10 guesses.
+	switch {
+	case bits < 10:
+		return 0
+	case bits < 20:
+		return 1
+	case bits < 27:
+		return 2
+	case bits < 33:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// commonPasswordWords are the stems most often found in leaked passwords.
+var commonPasswordWords = []string{
+	"password", "passw0rd", "qwerty", "letmein", "welcome", "admin", "login",
+	"iloveyou", "dragon", "monkey", "football", "baseball", "sunshine",
+	"princess", "master", "shadow", "superman", "batman", "trustno1",
+	"starwars", "whatever", "freedom", "secret", "hello", "charlie",
+	"michael", "jordan", "hunter", "killer", "soccer", "pokemon", "chirpy",
+	"123456", "654321", "111111", "000000", "abc123",
+}
+
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+func passwordEntropy(password string, context []string) float64 {
+	runes := []rune(password)
+	lower := []rune(strings.ToLower(password))
+	if len(lower) != len(runes) {
+		lower = runes
+	}
+
+	dictionary := slices.Concat(context, commonPasswordWords)
+	// Longer words first, so "password" is found before "pass".
+	slices.SortStableFunc(dictionary, func(a, b string) int {
+		return len(b) - len(a)
+	})
+	wordBits := math.Log2(float64(len(dictionary))) + 1
+
+	covered := make([]bool, len(lower))
+	bits := 0.0
+	for _, word := range dictionary {
+		w := []rune(word)
+		for i := 0; i+len(w) <= len(lower); i++ {
+			if string(lower[i:i+len(w)]) != word || slices.Contains(covered[i:i+len(w)], true) {
+				continue
+			}
+			for j := range w {
+				covered[i+j] = true
+			}
+			bits += wordBits
+		}
+	}
+
+	var prev rune
+	havePrev := false
+	for i, r := range runes {
+		if covered[i] {
+			havePrev = false
+			continue
+		}
+
+		if havePrev && (lower[i] == prev || adjacentRunes(prev, lower[i])) {
+			bits++
+		} else {
+			bits += math.Log2(charsetSize(r))
+		}
+		prev, havePrev = lower[i], true
+	}
+
+	return bits
+}
+
+func adjacentRunes(a, b rune) bool {
+	if (unicode.IsLetter(a) && unicode.IsLetter(b)) || (unicode.IsDigit(a) && unicode.IsDigit(b)) {
+		if a-b == 1 || b-a == 1 {
+			return true
+		}
+	}
+
+	for _, row := range keyboardRows {
+		i := strings.IndexRune(row, a)
+		j := strings.IndexRune(row, b)
+		if i >= 0 && j >= 0 && (i-j == 1 || j-i == 1) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func charsetSize(r rune) float64 {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		return 26
+	case r >= '0' && r <= '9':
+		return 10
+	case r < utf8.RuneSelf && unicode.IsPrint(r):
+		return 33
+	default:
+		return 100
+	}
+}
+
+// contextWords splits values like emails and handles into the lowercase
+// words a password should not be built from.
+func contextWords(values []string) []string {
+	words := []string{}
+	for _, value := range values {
+		fields := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, field := range fields {
+			if utf8.RuneCountInString(field) >= minContextWordLength && !slices.Contains(words, field) {
+				words = append(words, field)
+			}
+		}
+	}
+	return words
+}
+
+// BreachCorpus looks passwords up in a local copy of a k-anonymity range
+// corpus such as Have I Been Pwned's. Dir holds one file per 5 character
+// SHA-1 prefix, named like "21BD1.txt", whose lines are the remaining 35
+// characters of each hash, a colon and a count. Passwords never leave the
+// server and only one small file is read per check.
+type BreachCorpus struct {
+	Dir string
+}
+
+func (c BreachCorpus) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(c.Dir, prefix+".txt"))
+	if err != nil {
+		// Corpora can be trimmed to the most common hashes, so a missing
+		// range just means nothing in it was breached.
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hashSuffix, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !strings.EqualFold(hashSuffix, suffix) {
+			continue
+		}
+		// Padded ranges contain fake entries with a count of zero.
+		return count != "0", nil
+	}
+
+	return false, scanner.Err()
+}
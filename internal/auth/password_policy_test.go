@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPasswordScore(t *testing.T) {
+	testCases := []struct {
+		password string
+		context  []string
+		minScore int
+		maxScore int
+	}{
+		{"", nil, 0, 0},
+		{"password", nil, 0, 0},
+		{"aaaaaaaaaa", nil, 0, 1},
+		{"abcdefgh", nil, 0, 1},
+		{"qwertyuiop", nil, 0, 1},
+		{"Password123", nil, 0, 1},
+		{"gopher-lover", []string{"gopher.lover@example.com"}, 0, 1},
+		{"gopher-lover", nil, 4, 4},
+		{"Tr0ub4dor&3", nil, 3, 4},
+		{"correct horse battery staple", nil, 4, 4},
+	}
+
+	for _, tc := range testCases {
+		got := PasswordScore(tc.password, tc.context...)
+		if got < tc.minScore || got > tc.maxScore {
+			t.Errorf("PasswordScore(%q) = %d, expected between %d and %d", tc.password, got, tc.minScore, tc.maxScore)
+		}
+	}
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	dir := t.TempDir()
+	// SHA-1 of "correct horse battery staple" is
+	// ABF7AAD6438836DBE526AA231ABDE2D0EEF74D42.
+	err := os.WriteFile(filepath.Join(dir, "ABF7A.txt"), []byte("0000000000000000000000000000000000A:0\r\nAD6438836DBE526AA231ABDE2D0EEF74D42:120\r\n"), 0o600)
+	if err != nil {
+		t.Fatalf("WriteFile() returned an unexpected error: %v", err)
+	}
+
+	policy := DefaultPasswordPolicy
+	policy.Breaches = BreachCorpus{Dir: dir}
+
+	testCases := []struct {
+		name     string
+		password string
+		context  []string
+		expected []string
+	}{
+		{"strong", "plum-quartz-saddle-41", []string{"ann@example.com"}, nil},
+		{"short", "x", nil, []string{ViolationTooShort, ViolationTooWeak}},
+		{"personal", "frederick2024!", []string{"frederick@example.com", "fred_k"}, []string{ViolationPersonalInfo}},
+		{"breached", "correct horse battery staple", nil, []string{ViolationBreached}},
+		{"too long", string(make([]byte, 200)), nil, []string{ViolationTooLong}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			violations, err := policy.Check(tc.password, tc.context...)
+			if err != nil {
+				t.Fatalf("Check() returned an unexpected error: %v", err)
+			}
+
+			codes := []string{}
+			for _, v := range violations {
+				codes = append(codes, v.Code)
+			}
+			if !slices.Equal(codes, tc.expected) && !(len(codes) == 0 && len(tc.expected) == 0) {
+				t.Errorf("expected violations %v, but got %v", tc.expected, codes)
+			}
+		})
+	}
+}
+
+func TestBreachCorpusMissingRange(t *testing.T) {
+	breached, err := BreachCorpus{Dir: t.TempDir()}.IsBreached("password")
+	if err != nil {
+		t.Fatalf("IsBreached() returned an unexpected error: %v", err)
+	}
+	if breached {
+		t.Error("expected a password outside the corpus not to be breached")
+	}
+}
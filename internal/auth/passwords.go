@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alexedwards/argon2id"
+)
+
+// LegacyUnsetPassword is what migration 003 put in hashed_password for
+// accounts that existed before passwords did. It never matches a password.
+const LegacyUnsetPassword = "unset"
+
+type PasswordParams = argon2id.Params
+
+// DefaultPasswordParams pins Parallelism, unlike argon2id.DefaultParams which
+// uses the CPU count, so servers with different hardware agree on which
+// hashes are current.
+var DefaultPasswordParams = PasswordParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// PasswordHasher makes new hashes with one set of parameters and still
+// checks hashes made with any earlier ones.
+type PasswordHasher struct {
+	params PasswordParams
+}
+
+func NewPasswordHasher(params PasswordParams) (*PasswordHasher, error) {
+	if params.Iterations < 1 || params.Parallelism < 1 {
+		return nil, errors.New("argon2id iterations and parallelism must be at least 1")
+	}
+
+	if params.Memory < 8*uint32(params.Parallelism) {
+		return nil, errors.New("argon2id memory must be at least 8 KiB per thread")
+	}
+
+	if params.SaltLength < 16 || params.KeyLength < 16 {
+		return nil, errors.New("argon2id salt and key must be at least 16 bytes")
+	}
+
+	return &PasswordHasher{params: params}, nil
+}
+
+func (h *PasswordHasher) Params() PasswordParams {
+	return h.params
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	hashedPwd, err := argon2id.CreateHash(password, &h.params)
+	if err != nil {
+		fmt.Println(err)
+		return "", err
+	}
+	return hashedPwd, nil
+}
+
+func (h *PasswordHasher) Check(password, hash string) (bool, error) {
+	if hash == LegacyUnsetPassword {
+		return false, nil
+	}
+
+	matched, err := argon2id.ComparePasswordAndHash(password, hash)
+	if err != nil {
+		fmt.Println(err)
+		return false, err
+	}
+	return matched, nil
+}
+
+// NeedsRehash reports whether hash was made with anything other than the
+// current parameters, including hashes that are not Argon2id at all.
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	params, _, _, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return true
+	}
+
+	return *params != h.params
+}
+
+// HashPrefix is the start every hash made with the current parameters shares,
+// for counting them in the database. Salt and key length are not part of it.
+func (h *PasswordHasher) HashPrefix() string {
+	return fmt.Sprintf("$argon2id$v=19$m=%d,t=%d,p=%d$", h.params.Memory, h.params.Iterations, h.params.Parallelism)
+}
+
+var defaultPasswordHasher = &PasswordHasher{params: DefaultPasswordParams}
+
+// HashPassword hashes with DefaultPasswordParams. Servers with configured
+// parameters use PasswordHasher.Hash instead.
+func HashPassword(password string) (string, error) {
+	return defaultPasswordHasher.Hash(password)
+}
+
+func CheckPasswordHash(password, hash string) (bool, error) {
+	return defaultPasswordHasher.Check(password, hash)
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+var testPasswordParams = PasswordParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestPasswordHasherNeedsRehash(t *testing.T) {
+	oldHasher, err := NewPasswordHasher(testPasswordParams)
+	if err != nil {
+		t.Fatalf("NewPasswordHasher() returned an unexpected error: %v", err)
+	}
+
+	stronger := testPasswordParams
+	stronger.Iterations = 2
+	hasher, err := NewPasswordHasher(stronger)
+	if err != nil {
+		t.Fatalf("NewPasswordHasher() returned an unexpected error: %v", err)
+	}
+
+	oldHash, err := oldHasher.Hash("password")
+	if err != nil {
+		t.Fatalf("Hash() returned an unexpected error: %v", err)
+	}
+
+	newHash, err := hasher.Hash("password")
+	if err != nil {
+		t.Fatalf("Hash() returned an unexpected error: %v", err)
+	}
+
+	if !strings.HasPrefix(newHash, hasher.HashPrefix()) {
+		t.Errorf("expected %q to start with %q", newHash, hasher.HashPrefix())
+	}
+
+	if hasher.NeedsRehash(newHash) {
+		t.Error("expected a hash with the current parameters not to need a rehash")
+	}
+
+	if !hasher.NeedsRehash(oldHash) {
+		t.Error("expected a hash with outdated parameters to need a rehash")
+	}
+
+	if !hasher.NeedsRehash(LegacyUnsetPassword) {
+		t.Error("expected the legacy placeholder to need a rehash")
+	}
+
+	// Outdated hashes must keep working until they are replaced.
+	matched, err := hasher.Check("password", oldHash)
+	if err != nil || !matched {
+		t.Errorf("expected an outdated hash to still match, got %v, %v", matched, err)
+	}
+}
+
+func TestPasswordHasherLegacyUnset(t *testing.T) {
+	matched, err := CheckPasswordHash(LegacyUnsetPassword, LegacyUnsetPassword)
+	if err != nil {
+		t.Fatalf("CheckPasswordHash() returned an unexpected error: %v", err)
+	}
+	if matched {
+		t.Error("expected the legacy placeholder never to match")
+	}
+}
+
+func TestNewPasswordHasherRejectsWeakParams(t *testing.T) {
+	weak := testPasswordParams
+	weak.SaltLength = 8
+	if _, err := NewPasswordHasher(weak); err == nil {
+		t.Error("expected a short salt to be rejected")
+	}
+
+	weak = testPasswordParams
+	weak.Iterations = 0
+	if _, err := NewPasswordHasher(weak); err == nil {
+		t.Error("expected zero iterations to be rejected")
+	}
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// rfcSecret is the SHA1 seed from RFC 6238 appendix B.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+// TestTOTPCode checks the RFC 6238 test vectors, truncated to 6 digits.
+func TestTOTPCode(t *testing.T) {
+	testCases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tc := range testCases {
+		code, err := TOTPCode(rfcSecret, time.Unix(tc.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode() returned an unexpected error: %v", err)
+		}
+		if code != tc.code {
+			t.Errorf("at %d expected code %s, but got %s", tc.unix, tc.code, code)
+		}
+	}
+}
+
+// TestValidateTOTP verifies that codes are accepted one period either side of
+// the clock and rejected beyond that.
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() returned an unexpected error: %v", err)
+	}
+
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	code, err := TOTPCode(secret, clock.Now())
+	if err != nil {
+		t.Fatalf("TOTPCode() returned an unexpected error: %v", err)
+	}
+
+	step, ok := ValidateTOTP(secret, code, clock.Now())
+	if !ok {
+		t.Fatal("expected the current code to be valid")
+	}
+	if step != TOTPStep(clock.Now()) {
+		t.Errorf("expected step %d, but got %d", TOTPStep(clock.Now()), step)
+	}
+
+	clock.Advance(totpPeriod * time.Second)
+	if _, ok := ValidateTOTP(secret, code, clock.Now()); !ok {
+		t.Error("expected the previous period's code to still be valid")
+	}
+
+	clock.Advance(totpPeriod * time.Second)
+	if _, ok := ValidateTOTP(secret, code, clock.Now()); ok {
+		t.Error("expected a code two periods old to be rejected")
+	}
+
+	if _, ok := ValidateTOTP(secret, "12345", clock.Now()); ok {
+		t.Error("expected a short code to be rejected")
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() returned an unexpected error: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("expected 10 codes, but got %d", len(codes))
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("unexpected recovery code format: %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate recovery code: %q", code)
+		}
+		seen[code] = true
+	}
+}
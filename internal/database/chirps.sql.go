@@ -7,23 +7,66 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), now(), now(), $1, $2)
-RETURNING id, created_at, updated_at, body, user_id
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, parent_id, kind, original_id)
+VALUES (gen_random_uuid(), now(), now(), $1, $2, $3, $4, $5)
+RETURNING id, created_at, updated_at, body, user_id, parent_id, like_count, kind, original_id, edited_at, search_document
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body       string
+	UserID     uuid.UUID
+	ParentID   uuid.NullUUID
+	Kind       string
+	OriginalID uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.ParentID,
+		arg.Kind,
+		arg.OriginalID,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.ParentID,
+		&i.LikeCount,
+		&i.Kind,
+		&i.OriginalID,
+		&i.EditedAt,
+		&i.SearchDocument,
+	)
+	return i, err
+}
+
+const createRechirp = `-- name: CreateRechirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, kind, original_id)
+VALUES (gen_random_uuid(), now(), now(), '', $1, 'rechirp', $2)
+ON CONFLICT (user_id, original_id) WHERE kind = 'rechirp' DO NOTHING
+RETURNING id, created_at, updated_at, body, user_id, parent_id, like_count, kind, original_id, edited_at, search_document
+`
+
+type CreateRechirpParams struct {
+	UserID     uuid.UUID
+	OriginalID uuid.NullUUID
+}
+
+func (q *Queries) CreateRechirp(ctx context.Context, arg CreateRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createRechirp, arg.UserID, arg.OriginalID)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -31,13 +74,19 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ParentID,
+		&i.LikeCount,
+		&i.Kind,
+		&i.OriginalID,
+		&i.EditedAt,
+		&i.SearchDocument,
 	)
 	return i, err
 }
 
 const deleteChirp = `-- name: DeleteChirp :exec
 DELETE FROM chirps
-WHERE id = $1
+WHERE id = $1 OR (kind = 'rechirp' AND original_id = $1)
 `
 
 func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
@@ -45,9 +94,28 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteRechirp = `-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1 AND original_id = $2 AND kind = 'rechirp'
+`
+
+type DeleteRechirpParams struct {
+	UserID     uuid.UUID
+	OriginalID uuid.NullUUID
+}
+
+func (q *Queries) DeleteRechirp(ctx context.Context, arg DeleteRechirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRechirp, arg.UserID, arg.OriginalID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, parent_id, like_count, kind, original_id, edited_at, search_document
 FROM chirps
+WHERE user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
 ORDER BY created_at
 `
 
@@ -66,6 +134,12 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ParentID,
+			&i.LikeCount,
+			&i.Kind,
+			&i.OriginalID,
+			&i.EditedAt,
+			&i.SearchDocument,
 		); err != nil {
 			return nil, err
 		}
@@ -81,9 +155,9 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, parent_id, like_count, kind, original_id, edited_at, search_document
 FROM chirps
-WHERE id = $1
+WHERE id = $1 AND user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -95,14 +169,137 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ParentID,
+		&i.LikeCount,
+		&i.Kind,
+		&i.OriginalID,
+		&i.EditedAt,
+		&i.SearchDocument,
 	)
 	return i, err
 }
 
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors (id, parent_id, depth) AS (
+    SELECT chirps.id, chirps.parent_id, 1
+    FROM chirps
+    WHERE chirps.id = (SELECT c.parent_id FROM chirps c WHERE c.id = $1)
+    UNION ALL
+    SELECT chirps.id, chirps.parent_id, ancestors.depth + 1
+    FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.parent_id
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.like_count, chirps.kind, chirps.original_id, chirps.edited_at, chirps.search_document
+FROM chirps
+JOIN ancestors ON ancestors.id = chirps.id
+WHERE chirps.user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+ORDER BY ancestors.depth DESC
+`
+
+func (q *Queries) GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.LikeCount,
+			&i.Kind,
+			&i.OriginalID,
+			&i.EditedAt,
+			&i.SearchDocument,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpDescendants = `-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants (id, depth) AS (
+    SELECT chirps.id, 1
+    FROM chirps
+    WHERE chirps.parent_id = $1
+    UNION ALL
+    SELECT chirps.id, descendants.depth + 1
+    FROM chirps
+    JOIN descendants ON chirps.parent_id = descendants.id
+    WHERE descendants.depth < $2::int
+), capped AS (
+    -- Reading the recursive CTE without an ORDER BY lets Postgres stop
+    -- walking the tree as soon as the limit is reached.
+    SELECT id
+    FROM descendants
+    LIMIT $3
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.like_count, chirps.kind, chirps.original_id, chirps.edited_at, chirps.search_document
+FROM chirps
+JOIN capped ON capped.id = chirps.id
+WHERE chirps.user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+ORDER BY chirps.created_at, chirps.id
+`
+
+type GetChirpDescendantsParams struct {
+	ParentID uuid.NullUUID
+	MaxDepth int32
+	Limit    int32
+}
+
+func (q *Queries) GetChirpDescendants(ctx context.Context, arg GetChirpDescendantsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpDescendants, arg.ParentID, arg.MaxDepth, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.LikeCount,
+			&i.Kind,
+			&i.OriginalID,
+			&i.EditedAt,
+			&i.SearchDocument,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirpsByAuthor = `-- name: GetChirpsByAuthor :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, parent_id, like_count, kind, original_id, edited_at, search_document
 FROM chirps
-WHERE user_id = $1
+WHERE user_id = $1 AND user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
 ORDER BY created_at
 `
 
@@ -121,6 +318,12 @@ func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Ch
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ParentID,
+			&i.LikeCount,
+			&i.Kind,
+			&i.OriginalID,
+			&i.EditedAt,
+			&i.SearchDocument,
 		); err != nil {
 			return nil, err
 		}
@@ -134,3 +337,517 @@ func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Ch
 	}
 	return items, nil
 }
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, parent_id, like_count, kind, original_id, edited_at, search_document
+FROM chirps
+WHERE id = ANY($1::uuid[]) AND user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.LikeCount,
+			&i.Kind,
+			&i.OriginalID,
+			&i.EditedAt,
+			&i.SearchDocument,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsPageAsc = `-- name: GetChirpsPageAsc :many
+SELECT id, created_at, updated_at, body, user_id, parent_id, like_count, kind, original_id, edited_at, search_document
+FROM chirps
+WHERE user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND ($1::uuid IS NULL OR user_id = $1::uuid)
+  AND ($2::uuid IS NULL OR parent_id = $2::uuid)
+  AND ($3::timestamptz IS NULL
+    OR (created_at, id) > ($3::timestamptz, $4::uuid))
+ORDER BY created_at, id
+LIMIT $5
+`
+
+type GetChirpsPageAscParams struct {
+	AuthorID        uuid.NullUUID
+	ParentID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) GetChirpsPageAsc(ctx context.Context, arg GetChirpsPageAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsPageAsc,
+		arg.AuthorID,
+		arg.ParentID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.LikeCount,
+			&i.Kind,
+			&i.OriginalID,
+			&i.EditedAt,
+			&i.SearchDocument,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsPageDesc = `-- name: GetChirpsPageDesc :many
+SELECT id, created_at, updated_at, body, user_id, parent_id, like_count, kind, original_id, edited_at, search_document
+FROM chirps
+WHERE user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND ($1::uuid IS NULL OR user_id = $1::uuid)
+  AND ($2::uuid IS NULL OR parent_id = $2::uuid)
+  AND ($3::timestamptz IS NULL
+    OR (created_at, id) < ($3::timestamptz, $4::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $5
+`
+
+type GetChirpsPageDescParams struct {
+	AuthorID        uuid.NullUUID
+	ParentID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) GetChirpsPageDesc(ctx context.Context, arg GetChirpsPageDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsPageDesc,
+		arg.AuthorID,
+		arg.ParentID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.LikeCount,
+			&i.Kind,
+			&i.OriginalID,
+			&i.EditedAt,
+			&i.SearchDocument,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getHashtagChirpsPageAsc = `-- name: GetHashtagChirpsPageAsc :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.like_count, chirps.kind, chirps.original_id, chirps.edited_at, chirps.search_document
+FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+WHERE hashtags.tag = $1
+  AND chirps.user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND ($2::timestamptz IS NULL
+    OR (chirps.created_at, chirps.id) > ($2::timestamptz, $3::uuid))
+ORDER BY chirps.created_at, chirps.id
+LIMIT $4
+`
+
+type GetHashtagChirpsPageAscParams struct {
+	Tag             string
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) GetHashtagChirpsPageAsc(ctx context.Context, arg GetHashtagChirpsPageAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getHashtagChirpsPageAsc,
+		arg.Tag,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.LikeCount,
+			&i.Kind,
+			&i.OriginalID,
+			&i.EditedAt,
+			&i.SearchDocument,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getHashtagChirpsPageDesc = `-- name: GetHashtagChirpsPageDesc :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.like_count, chirps.kind, chirps.original_id, chirps.edited_at, chirps.search_document
+FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+WHERE hashtags.tag = $1
+  AND chirps.user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND ($2::timestamptz IS NULL
+    OR (chirps.created_at, chirps.id) < ($2::timestamptz, $3::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $4
+`
+
+type GetHashtagChirpsPageDescParams struct {
+	Tag             string
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) GetHashtagChirpsPageDesc(ctx context.Context, arg GetHashtagChirpsPageDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getHashtagChirpsPageDesc,
+		arg.Tag,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.LikeCount,
+			&i.Kind,
+			&i.OriginalID,
+			&i.EditedAt,
+			&i.SearchDocument,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTimelinePageAsc = `-- name: GetTimelinePageAsc :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.like_count, chirps.kind, chirps.original_id, chirps.edited_at, chirps.search_document
+FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = $1
+  AND chirps.user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND ($2::timestamptz IS NULL
+    OR (chirps.created_at, chirps.id) > ($2::timestamptz, $3::uuid))
+ORDER BY chirps.created_at, chirps.id
+LIMIT $4
+`
+
+type GetTimelinePageAscParams struct {
+	FollowerID      uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) GetTimelinePageAsc(ctx context.Context, arg GetTimelinePageAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getTimelinePageAsc,
+		arg.FollowerID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.LikeCount,
+			&i.Kind,
+			&i.OriginalID,
+			&i.EditedAt,
+			&i.SearchDocument,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTimelinePageDesc = `-- name: GetTimelinePageDesc :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.like_count, chirps.kind, chirps.original_id, chirps.edited_at, chirps.search_document
+FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = $1
+  AND chirps.user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND ($2::timestamptz IS NULL
+    OR (chirps.created_at, chirps.id) < ($2::timestamptz, $3::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $4
+`
+
+type GetTimelinePageDescParams struct {
+	FollowerID      uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) GetTimelinePageDesc(ctx context.Context, arg GetTimelinePageDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getTimelinePageDesc,
+		arg.FollowerID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.LikeCount,
+			&i.Kind,
+			&i.OriginalID,
+			&i.EditedAt,
+			&i.SearchDocument,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchChirps = `-- name: SearchChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.like_count, chirps.kind, chirps.original_id, chirps.edited_at,
+    ts_rank(chirps.search_document, websearch_to_tsquery('english', $1)) AS rank,
+    ts_headline('english', translate(chirps.body, E'\x02\x03', ''), websearch_to_tsquery('english', $1), E'StartSel=\x02, StopSel=\x03') AS snippet
+FROM chirps
+WHERE chirps.search_document @@ websearch_to_tsquery('english', $1)
+  AND chirps.user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND ($2::uuid IS NULL OR chirps.user_id = $2::uuid)
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT $3 OFFSET $4
+`
+
+type SearchChirpsParams struct {
+	Query      string
+	AuthorID   uuid.NullUUID
+	PageLimit  int32
+	PageOffset int32
+}
+
+type SearchChirpsRow struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	ParentID   uuid.NullUUID
+	LikeCount  int32
+	Kind       string
+	OriginalID uuid.NullUUID
+	EditedAt   sql.NullTime
+	Rank       float32
+	Snippet    string
+}
+
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.Query,
+		arg.AuthorID,
+		arg.PageLimit,
+		arg.PageOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsRow
+	for rows.Next() {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.LikeCount,
+			&i.Kind,
+			&i.OriginalID,
+			&i.EditedAt,
+			&i.Rank,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+WITH revision AS (
+    INSERT INTO chirp_revisions (id, chirp_id, created_at, body)
+    SELECT gen_random_uuid(), chirps.id, now(), chirps.body
+    FROM chirps
+    WHERE chirps.id = $1
+    FOR UPDATE
+)
+UPDATE chirps
+SET body = $2, updated_at = now(), edited_at = now()
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, parent_id, like_count, kind, original_id, edited_at, search_document
+`
+
+type UpdateChirpBodyParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.ParentID,
+		&i.LikeCount,
+		&i.Kind,
+		&i.OriginalID,
+		&i.EditedAt,
+		&i.SearchDocument,
+	)
+	return i, err
+}
@@ -0,0 +1,169 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatMessage(t *testing.T) {
+	date := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	msg := formatMessage("Chirpy <no-reply@chirpy.test>", Message{
+		To:      "user@example.com\r\nBcc: victim@example.com",
+		Subject: "Reset your password",
+		Body:    "line one\nline two",
+	}, date)
+
+	got := string(msg)
+	if strings.Contains(got, "\r\nBcc:") {
+		t.Errorf("expected header injection to be stripped, got:\n%s", got)
+	}
+	if !strings.Contains(got, "Subject: Reset your password\r\n") {
+		t.Errorf("expected a subject header, got:\n%s", got)
+	}
+	if !strings.HasSuffix(got, "\r\n\r\nline one\r\nline two\r\n") {
+		t.Errorf("expected a CRLF body after a blank line, got:\n%s", got)
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	buf := &bytes.Buffer{}
+	m := &LogMailer{From: "no-reply@chirpy.test", W: buf}
+
+	err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Hello", Body: "hi"})
+	if err != nil {
+		t.Fatalf("Send() returned an unexpected error: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "To: user@example.com") {
+		t.Errorf("expected the message to be written, got:\n%s", buf.String())
+	}
+}
+
+// fakeRelay accepts one SMTP session on a local port and records the
+// commands it was sent. A stuck relay accepts the connection and never
+// answers.
+func fakeRelay(t *testing.T, stuck bool) (addr string, commands <-chan []string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() returned an unexpected error: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	done := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- nil
+			return
+		}
+		defer conn.Close()
+
+		if stuck {
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			bufio.NewReader(conn).ReadString(0)
+			done <- nil
+			return
+		}
+
+		received := []string{}
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 relay.test ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				done <- received
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			received = append(received, line)
+
+			switch verb, _, _ := strings.Cut(line, " "); strings.ToUpper(verb) {
+			case "EHLO", "HELO":
+				reply("250 relay.test")
+			case "DATA":
+				reply("354 go ahead")
+				for {
+					body, err := r.ReadString('\n')
+					if err != nil || body == ".\r\n" {
+						break
+					}
+				}
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				done <- received
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	return ln.Addr().String(), done
+}
+
+func TestSMTPMailerEnvelope(t *testing.T) {
+	addr, commands := fakeRelay(t, false)
+	m := &SMTPMailer{Addr: addr, From: "Chirpy <no-reply@chirpy.test>"}
+
+	err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Hello", Body: "hi"})
+	if err != nil {
+		t.Fatalf("Send() returned an unexpected error: %v", err)
+	}
+
+	got := strings.Join(<-commands, "\n")
+	if !strings.Contains(got, "MAIL FROM:<no-reply@chirpy.test>") {
+		t.Errorf("expected the bare sender address in the envelope, got:\n%s", got)
+	}
+	if !strings.Contains(got, "RCPT TO:<user@example.com>") {
+		t.Errorf("expected the recipient in the envelope, got:\n%s", got)
+	}
+}
+
+func TestSMTPMailerRejectsBadSender(t *testing.T) {
+	m := &SMTPMailer{Addr: "127.0.0.1:1", From: "not an address"}
+
+	err := m.Send(context.Background(), Message{To: "user@example.com"})
+	if err == nil {
+		t.Error("expected an unparseable sender to be rejected")
+	}
+}
+
+func TestSMTPMailerTimeout(t *testing.T) {
+	addr, _ := fakeRelay(t, true)
+	m := &SMTPMailer{Addr: addr, From: "no-reply@chirpy.test", Timeout: 100 * time.Millisecond}
+
+	start := time.Now()
+	err := m.Send(context.Background(), Message{To: "user@example.com"})
+	if err == nil {
+		t.Fatal("expected a relay that never answers to fail the send")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected Send() to give up after its timeout, took %s", elapsed)
+	}
+}
+
+func TestSMTPMailerContextCancelled(t *testing.T) {
+	addr, _ := fakeRelay(t, true)
+	m := &SMTPMailer{Addr: addr, From: "no-reply@chirpy.test"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := m.Send(ctx, Message{To: "user@example.com"})
+	if err == nil {
+		t.Fatal("expected a cancelled context to fail the send")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected Send() to stop with the context, took %s", elapsed)
+	}
+}
@@ -1,12 +1,21 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"net/http"
+	"net/mail"
+	"net/netip"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/FerMusicComposer/chirpy/internal/auth"
 	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/FerMusicComposer/chirpy/internal/mailer"
 	"github.com/FerMusicComposer/chirpy/src/handlers"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -27,8 +36,42 @@ func main() {
 	cfg := &handlers.ApiConfig{}
 	cfg.DbQueries = dbQueries
 	cfg.Environment = os.Getenv("PLATFORM")
-	cfg.JWTSecret = os.Getenv("JWT_SECRET")
+	cfg.JWTKeys, err = loadJWTKeys()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	cfg.Passwords, err = loadPasswordHasher()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	cfg.PasswordPolicy, err = loadPasswordPolicy()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 	cfg.PolkaKey = os.Getenv("POLKA_KEY")
+	cfg.Clock = auth.SystemClock
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	cfg.EmailLinks, err = loadEmailLinks(baseURL)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	cfg.Mailer, err = newMailer()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	cfg.TrustedProxies, err = loadTrustedProxies()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
 	mux := http.NewServeMux()
 	server := &http.Server{
@@ -40,30 +83,274 @@ func main() {
 	mux.Handle("/app/", cfg.WithMetrics(http.HandlerFunc(handlers.ServeAppFiles)))
 	mux.Handle("/app/assets/", cfg.WithMetrics(http.HandlerFunc(handlers.ServeAppAssets)))
 	mux.HandleFunc("GET /api/healthz", handlers.GetHealthz)
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.GetJWKS)
 
 	// Auth
 	mux.HandleFunc("POST /api/login", cfg.Login)
+	mux.HandleFunc("POST /api/login/mfa", cfg.LoginMFA)
+	mux.HandleFunc("POST /api/login/magic", cfg.RequestMagicLink)
+	mux.HandleFunc("POST /api/login/magic/redeem", cfg.RedeemMagicLink)
 	mux.HandleFunc("POST /api/refresh", cfg.RefreshToken)
 	mux.HandleFunc("POST /api/revoke", cfg.RevokeToken)
+	mux.HandleFunc("POST /api/password/forgot", cfg.ForgotPassword)
+	mux.HandleFunc("POST /api/password/reset", cfg.ResetPassword)
+	mux.HandleFunc("POST /api/email/verify", cfg.VerifyEmail)
+	mux.Handle("POST /api/email/verify/resend", cfg.RequireAuth(http.HandlerFunc(cfg.ResendEmailVerification), auth.ScopeAccount))
+	mux.Handle("GET /api/sessions", cfg.RequireAuth(http.HandlerFunc(cfg.GetSessions), auth.ScopeAccount))
+	mux.Handle("DELETE /api/sessions", cfg.RequireAuth(http.HandlerFunc(cfg.RevokeAllSessions), auth.ScopeAccount))
+	mux.Handle("DELETE /api/sessions/{id}", cfg.RequireAuth(http.HandlerFunc(cfg.RevokeSession), auth.ScopeAccount))
+	mux.Handle("POST /api/tokens", cfg.RequireAuth(http.HandlerFunc(cfg.CreatePersonalAccessToken), auth.ScopeAccount))
+	mux.Handle("GET /api/tokens", cfg.RequireAuth(http.HandlerFunc(cfg.GetPersonalAccessTokens), auth.ScopeAccount))
+	mux.Handle("DELETE /api/tokens/{id}", cfg.RequireAuth(http.HandlerFunc(cfg.RevokePersonalAccessToken), auth.ScopeAccount))
 
 	// Chirps
-	mux.HandleFunc("POST /api/chirps", cfg.CreateChirp)
-	mux.HandleFunc("GET /api/chirps", cfg.GetChirps)
-	mux.HandleFunc("GET /api/chirps/{id}", cfg.GetChirp)
-	mux.HandleFunc("DELETE /api/chirps/{id}", cfg.DeleteChirp)
+	mux.Handle("POST /api/chirps", cfg.RequireAuth(http.HandlerFunc(cfg.CreateChirp), auth.ScopeChirpsWrite))
+	mux.Handle("GET /api/chirps", cfg.OptionalAuth(http.HandlerFunc(cfg.GetChirps)))
+	mux.Handle("GET /api/chirps/search", cfg.OptionalAuth(http.HandlerFunc(cfg.SearchChirps)))
+	mux.Handle("GET /api/chirps/{id}", cfg.OptionalAuth(http.HandlerFunc(cfg.GetChirp)))
+	mux.Handle("PATCH /api/chirps/{id}", cfg.RequireAuth(http.HandlerFunc(cfg.UpdateChirp), auth.ScopeChirpsWrite))
+	mux.Handle("DELETE /api/chirps/{id}", cfg.RequireAuth(http.HandlerFunc(cfg.DeleteChirp), auth.ScopeChirpsWrite))
+	mux.HandleFunc("GET /api/chirps/{id}/revisions", cfg.GetChirpRevisions)
+	mux.Handle("GET /api/chirps/{id}/replies", cfg.OptionalAuth(http.HandlerFunc(cfg.GetChirpReplies)))
+	mux.Handle("GET /api/chirps/{id}/thread", cfg.OptionalAuth(http.HandlerFunc(cfg.GetChirpThread)))
+	mux.Handle("POST /api/chirps/{id}/likes", cfg.RequireAuth(http.HandlerFunc(cfg.LikeChirp), auth.ScopeChirpsWrite))
+	mux.Handle("DELETE /api/chirps/{id}/likes", cfg.RequireAuth(http.HandlerFunc(cfg.UnlikeChirp), auth.ScopeChirpsWrite))
+	mux.Handle("POST /api/chirps/{id}/rechirp", cfg.RequireAuth(http.HandlerFunc(cfg.Rechirp), auth.ScopeChirpsWrite))
+	mux.Handle("DELETE /api/chirps/{id}/rechirp", cfg.RequireAuth(http.HandlerFunc(cfg.Unrechirp), auth.ScopeChirpsWrite))
+	mux.Handle("GET /api/timeline", cfg.RequireAuth(http.HandlerFunc(cfg.GetTimeline), auth.ScopeChirpsRead))
+
+	// Notifications
+	mux.Handle("GET /api/notifications", cfg.RequireAuth(http.HandlerFunc(cfg.GetNotifications), auth.ScopeChirpsRead))
+
+	// Hashtags
+	mux.Handle("GET /api/hashtags/{tag}/chirps", cfg.OptionalAuth(http.HandlerFunc(cfg.GetHashtagChirps)))
+	mux.HandleFunc("GET /api/trending", cfg.GetTrending)
 
 	// Users
 	mux.HandleFunc("POST /api/users", cfg.CreateUser)
-	mux.HandleFunc("PUT /api/users", cfg.UpdateUser)
+	mux.Handle("PUT /api/users", cfg.RequireAuth(http.HandlerFunc(cfg.UpdateUser), auth.ScopeAccount))
+	mux.Handle("PATCH /api/users/me", cfg.RequireAuth(http.HandlerFunc(cfg.PatchCurrentUser), auth.ScopeAccount))
+	mux.Handle("DELETE /api/users/me", cfg.RequireAuth(http.HandlerFunc(cfg.DeleteCurrentUser), auth.ScopeAccount))
+	mux.Handle("POST /api/users/me/totp", cfg.RequireAuth(http.HandlerFunc(cfg.EnrollTOTP), auth.ScopeAccount))
+	mux.Handle("POST /api/users/me/totp/verify", cfg.RequireAuth(http.HandlerFunc(cfg.VerifyTOTP), auth.ScopeAccount))
+	mux.Handle("DELETE /api/users/me/totp", cfg.RequireAuth(http.HandlerFunc(cfg.DisableTOTP), auth.ScopeAccount))
+	mux.Handle("POST /api/users/me/totp/recovery-codes", cfg.RequireAuth(http.HandlerFunc(cfg.RegenerateRecoveryCodes), auth.ScopeAccount))
+	mux.HandleFunc("GET /api/users/{handle}", cfg.GetProfile)
+
+	// Follows
+	mux.Handle("POST /api/users/{id}/follow", cfg.RequireAuth(http.HandlerFunc(cfg.FollowUser), auth.ScopeChirpsWrite))
+	mux.Handle("DELETE /api/users/{id}/follow", cfg.RequireAuth(http.HandlerFunc(cfg.UnfollowUser), auth.ScopeChirpsWrite))
+	mux.HandleFunc("GET /api/users/{id}/followers", cfg.GetFollowers)
+	mux.HandleFunc("GET /api/users/{id}/following", cfg.GetFollowing)
 
 	// Admin
 	mux.HandleFunc("GET /admin/metrics", http.HandlerFunc(cfg.ServeMetrics))
+	mux.Handle("GET /admin/metrics/passwords", cfg.RequireAuth(cfg.RequireRole(auth.RoleAdmin, http.HandlerFunc(cfg.ServePasswordMetrics)), auth.ScopeAccount))
 	mux.HandleFunc("POST /admin/reset", http.HandlerFunc(cfg.ResetMetrics))
+	mux.Handle("POST /admin/users/{id}/unlock", cfg.RequireAuth(cfg.RequireRole(auth.RoleAdmin, http.HandlerFunc(cfg.UnlockUser)), auth.ScopeAccount))
 
 	// Webhooks
 	mux.HandleFunc("POST /api/polka/webhooks", cfg.UpdateUserSubscriptionWebhook)
 
+	go cfg.RunAccountPurge(context.Background(), time.Hour)
+
 	fmt.Println("Listening on port 8080")
 	server.ListenAndServe()
 
 }
+
+// loadJWTKeys signs with JWT_SECRET (HS256) unless JWT_KEYS_DIR holds PEM keys,
+// in which case JWT_SIGNING_KID picks the active one. To rotate, add the new
+// key and give verifiers time to fetch it from the JWKS, then switch
+// JWT_SIGNING_KID and keep only the old key's public half until the last
+// tokens it signed have expired.
+func loadJWTKeys() (*auth.KeySet, error) {
+	secret := os.Getenv("JWT_SECRET")
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		return auth.NewKeySet("", auth.NewHMACKey("", []byte(secret)))
+	}
+
+	// Without an explicit kid the empty one would pick a key nobody chose.
+	signingKid := os.Getenv("JWT_SIGNING_KID")
+	if signingKid == "" {
+		return nil, fmt.Errorf("JWT_SIGNING_KID is required when JWT_KEYS_DIR is set")
+	}
+
+	keys, err := auth.LoadPEMKeys(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens issued with the shared secret before the switch carry no kid.
+	// They are only accepted when JWT_LEGACY_HS256_UNTIL asks for it, and
+	// only until then; an hour after the switch is enough for access tokens.
+	if v := os.Getenv("JWT_LEGACY_HS256_UNTIL"); v != "" {
+		until, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT_LEGACY_HS256_UNTIL: %w", err)
+		}
+		if secret == "" {
+			return nil, fmt.Errorf("JWT_LEGACY_HS256_UNTIL needs JWT_SECRET")
+		}
+		if until.After(time.Now()) {
+			keys = append(keys, auth.NewLegacyHMACKey([]byte(secret), until))
+		}
+	}
+
+	return auth.NewKeySet(signingKid, keys...)
+}
+
+// loadPasswordHasher starts from auth.DefaultPasswordParams and lets
+// ARGON2_MEMORY_KIB, ARGON2_ITERATIONS and ARGON2_PARALLELISM override them.
+// Existing hashes are upgraded as their users log in.
+func loadPasswordHasher() (*auth.PasswordHasher, error) {
+	params := auth.DefaultPasswordParams
+
+	if v := os.Getenv("ARGON2_MEMORY_KIB"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ARGON2_MEMORY_KIB: %w", err)
+		}
+		params.Memory = uint32(n)
+	}
+
+	if v := os.Getenv("ARGON2_ITERATIONS"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ARGON2_ITERATIONS: %w", err)
+		}
+		params.Iterations = uint32(n)
+	}
+
+	if v := os.Getenv("ARGON2_PARALLELISM"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ARGON2_PARALLELISM: %w", err)
+		}
+		params.Parallelism = uint8(n)
+	}
+
+	return auth.NewPasswordHasher(params)
+}
+
+// loadPasswordPolicy starts from auth.DefaultPasswordPolicy and lets
+// PASSWORD_MIN_LENGTH and PASSWORD_MIN_SCORE override it. Breached passwords
+// are only checked when BREACHED_PASSWORDS_DIR points at a range corpus.
+func loadPasswordPolicy() (auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy
+
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return policy, fmt.Errorf("invalid PASSWORD_MIN_LENGTH: %q", v)
+		}
+		policy.MinLength = n
+	}
+
+	if v := os.Getenv("PASSWORD_MIN_SCORE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 4 {
+			return policy, fmt.Errorf("invalid PASSWORD_MIN_SCORE: %q, must be 0-4", v)
+		}
+		policy.MinScore = n
+	}
+
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return policy, err
+		}
+		if !info.IsDir() {
+			return policy, fmt.Errorf("BREACHED_PASSWORDS_DIR %s is not a directory", dir)
+		}
+		policy.Breaches = auth.BreachCorpus{Dir: dir}
+	}
+
+	return policy, nil
+}
+
+// loadEmailLinks points the links in emails at the pages served under /app/
+// unless an environment variable names a page of another client instead.
+func loadEmailLinks(baseURL string) (handlers.EmailLinks, error) {
+	links := handlers.EmailLinks{
+		ResetPassword: baseURL + "/app/reset-password.html",
+		VerifyEmail:   baseURL + "/app/verify-email.html",
+		MagicLogin:    baseURL + "/app/magic-login.html",
+	}
+
+	for env, link := range map[string]*string{
+		"RESET_PASSWORD_URL": &links.ResetPassword,
+		"VERIFY_EMAIL_URL":   &links.VerifyEmail,
+		"MAGIC_LOGIN_URL":    &links.MagicLogin,
+	} {
+		if v := os.Getenv(env); v != "" {
+			*link = v
+		}
+
+		u, err := url.Parse(*link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return links, fmt.Errorf("invalid %s: %q, must be an http or https URL", env, *link)
+		}
+	}
+
+	return links, nil
+}
+
+// loadTrustedProxies reads TRUSTED_PROXIES, a comma separated list of the
+// addresses or CIDR ranges of the load balancers in front of the server. Leave
+// it empty when clients connect directly, or they could forge their address.
+func loadTrustedProxies() ([]netip.Prefix, error) {
+	proxies := []netip.Prefix{}
+	for _, v := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(v)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry: %q", v)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+
+	return proxies, nil
+}
+
+// newMailer sends through SMTP_ADDR when it is set. Otherwise mail is written
+// to MAIL_FILE, or to stdout, so development needs no mail server.
+func newMailer() (mailer.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@chirpy.local>"
+	}
+
+	_, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAIL_FROM: %w", err)
+	}
+
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		return &mailer.SMTPMailer{
+			Addr:     addr,
+			From:     from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}, nil
+	}
+
+	if path := os.Getenv("MAIL_FILE"); path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		return &mailer.LogMailer{From: from, W: f}, nil
+	}
+
+	return &mailer.LogMailer{From: from, W: os.Stdout}, nil
+}
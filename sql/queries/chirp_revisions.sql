@@ -0,0 +1,5 @@
+-- name: GetChirpRevisions :many
+SELECT id, chirp_id, created_at, body
+FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY created_at DESC;
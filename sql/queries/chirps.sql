@@ -1,24 +1,171 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), now(), now(), $1, $2)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, parent_id, kind, original_id)
+VALUES (gen_random_uuid(), now(), now(), $1, $2, $3, $4, $5)
 RETURNING *;
 
+-- name: CreateRechirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, kind, original_id)
+VALUES (gen_random_uuid(), now(), now(), '', $1, 'rechirp', $2)
+ON CONFLICT (user_id, original_id) WHERE kind = 'rechirp' DO NOTHING
+RETURNING *;
+
+-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1 AND original_id = $2 AND kind = 'rechirp';
+
 -- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, parent_id, like_count, kind, original_id, edited_at, search_document
 FROM chirps
+WHERE user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
 ORDER BY created_at;
 
 -- name: GetChirpsByAuthor :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, parent_id, like_count, kind, original_id, edited_at, search_document
 FROM chirps
-WHERE user_id = $1
+WHERE user_id = $1 AND user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
 ORDER BY created_at;
 
 -- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, parent_id, like_count, kind, original_id, edited_at, search_document
 FROM chirps
-WHERE id = $1;
+WHERE id = $1 AND user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL);
+
+-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, parent_id, like_count, kind, original_id, edited_at, search_document
+FROM chirps
+WHERE id = ANY(sqlc.arg('ids')::uuid[]) AND user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL);
+
+-- name: UpdateChirpBody :one
+WITH revision AS (
+    INSERT INTO chirp_revisions (id, chirp_id, created_at, body)
+    SELECT gen_random_uuid(), chirps.id, now(), chirps.body
+    FROM chirps
+    WHERE chirps.id = $1
+    FOR UPDATE
+)
+UPDATE chirps
+SET body = $2, updated_at = now(), edited_at = now()
+WHERE id = $1
+RETURNING *;
 
 -- name: DeleteChirp :exec
 DELETE FROM chirps
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1 OR (kind = 'rechirp' AND original_id = $1);
+
+-- name: GetChirpsPageAsc :many
+SELECT id, created_at, updated_at, body, user_id, parent_id, like_count, kind, original_id, edited_at, search_document
+FROM chirps
+WHERE user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('parent_id')::uuid IS NULL OR parent_id = sqlc.narg('parent_id')::uuid)
+  AND (sqlc.narg('cursor_created_at')::timestamptz IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamptz, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at, id
+LIMIT sqlc.arg('page_limit');
+
+-- name: GetChirpsPageDesc :many
+SELECT id, created_at, updated_at, body, user_id, parent_id, like_count, kind, original_id, edited_at, search_document
+FROM chirps
+WHERE user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('parent_id')::uuid IS NULL OR parent_id = sqlc.narg('parent_id')::uuid)
+  AND (sqlc.narg('cursor_created_at')::timestamptz IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamptz, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- name: GetTimelinePageAsc :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.like_count, chirps.kind, chirps.original_id, chirps.edited_at, chirps.search_document
+FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = sqlc.arg('follower_id')
+  AND chirps.user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND (sqlc.narg('cursor_created_at')::timestamptz IS NULL
+    OR (chirps.created_at, chirps.id) > (sqlc.narg('cursor_created_at')::timestamptz, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at, chirps.id
+LIMIT sqlc.arg('page_limit');
+
+-- name: GetTimelinePageDesc :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.like_count, chirps.kind, chirps.original_id, chirps.edited_at, chirps.search_document
+FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = sqlc.arg('follower_id')
+  AND chirps.user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND (sqlc.narg('cursor_created_at')::timestamptz IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamptz, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors (id, parent_id, depth) AS (
+    SELECT chirps.id, chirps.parent_id, 1
+    FROM chirps
+    WHERE chirps.id = (SELECT c.parent_id FROM chirps c WHERE c.id = $1)
+    UNION ALL
+    SELECT chirps.id, chirps.parent_id, ancestors.depth + 1
+    FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.parent_id
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.like_count, chirps.kind, chirps.original_id, chirps.edited_at, chirps.search_document
+FROM chirps
+JOIN ancestors ON ancestors.id = chirps.id
+WHERE chirps.user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+ORDER BY ancestors.depth DESC;
+
+-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants (id, depth) AS (
+    SELECT chirps.id, 1
+    FROM chirps
+    WHERE chirps.parent_id = sqlc.arg('parent_id')
+    UNION ALL
+    SELECT chirps.id, descendants.depth + 1
+    FROM chirps
+    JOIN descendants ON chirps.parent_id = descendants.id
+    WHERE descendants.depth < sqlc.arg('max_depth')::int
+), capped AS (
+    -- Reading the recursive CTE without an ORDER BY lets Postgres stop
+    -- walking the tree as soon as the limit is reached.
+    SELECT id
+    FROM descendants
+    LIMIT sqlc.arg('limit')
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.like_count, chirps.kind, chirps.original_id, chirps.edited_at, chirps.search_document
+FROM chirps
+JOIN capped ON capped.id = chirps.id
+WHERE chirps.user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+ORDER BY chirps.created_at, chirps.id;
+
+-- name: SearchChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.like_count, chirps.kind, chirps.original_id, chirps.edited_at,
+    ts_rank(chirps.search_document, websearch_to_tsquery('english', sqlc.arg('query'))) AS rank,
+    ts_headline('english', translate(chirps.body, E'\x02\x03', ''), websearch_to_tsquery('english', sqlc.arg('query')), E'StartSel=\x02, StopSel=\x03') AS snippet
+FROM chirps
+WHERE chirps.search_document @@ websearch_to_tsquery('english', sqlc.arg('query'))
+  AND chirps.user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND (sqlc.narg('author_id')::uuid IS NULL OR chirps.user_id = sqlc.narg('author_id')::uuid)
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit') OFFSET sqlc.arg('page_offset');
+
+-- name: GetHashtagChirpsPageAsc :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.like_count, chirps.kind, chirps.original_id, chirps.edited_at, chirps.search_document
+FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+WHERE hashtags.tag = sqlc.arg('tag')
+  AND chirps.user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND (sqlc.narg('cursor_created_at')::timestamptz IS NULL
+    OR (chirps.created_at, chirps.id) > (sqlc.narg('cursor_created_at')::timestamptz, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at, chirps.id
+LIMIT sqlc.arg('page_limit');
+
+-- name: GetHashtagChirpsPageDesc :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.parent_id, chirps.like_count, chirps.kind, chirps.original_id, chirps.edited_at, chirps.search_document
+FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+WHERE hashtags.tag = sqlc.arg('tag')
+  AND chirps.user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND (sqlc.narg('cursor_created_at')::timestamptz IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamptz, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit');
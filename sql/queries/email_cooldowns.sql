@@ -0,0 +1,11 @@
+-- name: StartEmailCooldown :execrows
+INSERT INTO email_cooldowns (kind, email, sent_at)
+VALUES (sqlc.arg('kind'), sqlc.arg('email'), sqlc.arg('now')::timestamptz)
+ON CONFLICT (kind, email) DO UPDATE
+SET sent_at = sqlc.arg('now')::timestamptz
+WHERE email_cooldowns.sent_at <= sqlc.arg('now')::timestamptz - make_interval(secs => sqlc.arg('cooldown_seconds')::int);
+
+-- name: GetEmailCooldownRetryAfter :one
+SELECT COALESCE(ceil(extract(epoch FROM max(sent_at) + make_interval(secs => sqlc.arg('cooldown_seconds')::int) - sqlc.arg('now')::timestamptz)), 0)::int AS retry_after
+FROM email_cooldowns
+WHERE kind = sqlc.arg('kind') AND email = sqlc.arg('email');
@@ -0,0 +1,20 @@
+-- name: CreateEmailVerificationToken :exec
+INSERT INTO email_verification_tokens (token_hash, created_at, user_id, email, expires_at, used_at)
+VALUES ($1, now(), $2, $3, $4, null);
+
+-- name: GetEmailVerificationRetryAfter :one
+SELECT COALESCE(ceil(extract(epoch FROM max(created_at) + make_interval(secs => sqlc.arg('cooldown_seconds')::int) - now())), 0)::int AS retry_after
+FROM email_verification_tokens
+WHERE user_id = sqlc.arg('user_id')
+    AND created_at > now() - make_interval(secs => sqlc.arg('cooldown_seconds')::int);
+
+-- name: UseEmailVerificationToken :one
+UPDATE email_verification_tokens
+SET used_at = now()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+RETURNING user_id, email;
+
+-- name: VerifyUserEmail :execrows
+UPDATE users
+SET updated_at = now(), email_verified_at = now()
+WHERE id = $1 AND email = $2 AND email_verified_at IS NULL;
@@ -0,0 +1,48 @@
+-- name: CreateFollow :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES ($1, $2, now())
+ON CONFLICT (follower_id, followee_id) DO NOTHING;
+
+-- name: DeleteFollow :exec
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: GetFollowersPageAsc :many
+SELECT follower_id, followee_id, created_at
+FROM follows
+WHERE followee_id = sqlc.arg('followee_id')
+  AND follower_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND (sqlc.narg('cursor_created_at')::timestamptz IS NULL
+    OR (created_at, follower_id) > (sqlc.narg('cursor_created_at')::timestamptz, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at, follower_id
+LIMIT sqlc.arg('page_limit');
+
+-- name: GetFollowersPageDesc :many
+SELECT follower_id, followee_id, created_at
+FROM follows
+WHERE followee_id = sqlc.arg('followee_id')
+  AND follower_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND (sqlc.narg('cursor_created_at')::timestamptz IS NULL
+    OR (created_at, follower_id) < (sqlc.narg('cursor_created_at')::timestamptz, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, follower_id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- name: GetFollowingPageAsc :many
+SELECT follower_id, followee_id, created_at
+FROM follows
+WHERE follower_id = sqlc.arg('follower_id')
+  AND followee_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND (sqlc.narg('cursor_created_at')::timestamptz IS NULL
+    OR (created_at, followee_id) > (sqlc.narg('cursor_created_at')::timestamptz, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at, followee_id
+LIMIT sqlc.arg('page_limit');
+
+-- name: GetFollowingPageDesc :many
+SELECT follower_id, followee_id, created_at
+FROM follows
+WHERE follower_id = sqlc.arg('follower_id')
+  AND followee_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+  AND (sqlc.narg('cursor_created_at')::timestamptz IS NULL
+    OR (created_at, followee_id) < (sqlc.narg('cursor_created_at')::timestamptz, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, followee_id DESC
+LIMIT sqlc.arg('page_limit');
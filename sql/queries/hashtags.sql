@@ -0,0 +1,38 @@
+-- name: UpsertHashtag :one
+INSERT INTO hashtags (id, created_at, tag)
+VALUES (gen_random_uuid(), now(), $1)
+ON CONFLICT (tag) DO UPDATE SET tag = EXCLUDED.tag
+RETURNING *;
+
+-- name: CreateChirpHashtag :exec
+INSERT INTO chirp_hashtags (chirp_id, hashtag_id, created_at)
+VALUES ($1, $2, now())
+ON CONFLICT (chirp_id, hashtag_id) DO NOTHING;
+
+-- name: DeleteStaleChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = sqlc.arg('chirp_id')
+  AND hashtag_id NOT IN (SELECT id FROM hashtags WHERE tag = ANY(sqlc.arg('tags')::text[]));
+
+-- name: GetTrendingHashtags :many
+-- hashtag_usage still counts accounts pending deletion until they are
+-- purged, so their links in the window are subtracted here. Only hidden
+-- accounts' chirps are scanned, which keeps the ranking incremental.
+WITH hidden AS (
+    SELECT chirp_hashtags.hashtag_id, count(*) AS uses
+    FROM chirp_hashtags
+    JOIN chirps ON chirps.id = chirp_hashtags.chirp_id
+    JOIN users ON users.id = chirps.user_id
+    WHERE users.deleted_at IS NOT NULL
+      AND date_trunc('hour', chirp_hashtags.created_at) >= sqlc.arg('bucket')::timestamptz
+    GROUP BY chirp_hashtags.hashtag_id
+)
+SELECT hashtags.tag, (SUM(hashtag_usage.uses) - COALESCE(MAX(hidden.uses), 0))::bigint AS uses
+FROM hashtag_usage
+JOIN hashtags ON hashtags.id = hashtag_usage.hashtag_id
+LEFT JOIN hidden ON hidden.hashtag_id = hashtag_usage.hashtag_id
+WHERE hashtag_usage.bucket >= sqlc.arg('bucket')::timestamptz
+GROUP BY hashtags.tag
+HAVING SUM(hashtag_usage.uses) - COALESCE(MAX(hidden.uses), 0) > 0
+ORDER BY uses DESC, hashtags.tag
+LIMIT sqlc.arg('limit');
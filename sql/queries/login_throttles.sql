@@ -0,0 +1,25 @@
+-- name: GetLoginRetryAfter :one
+SELECT COALESCE(ceil(extract(epoch FROM max(locked_until) - sqlc.arg('now')::timestamptz)), 0)::int AS retry_after
+FROM login_throttles
+WHERE ((scope = 'account' AND key = sqlc.arg('account_key')) OR (scope = 'ip' AND key = sqlc.arg('ip_key')))
+    AND locked_until > sqlc.arg('now')::timestamptz;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_throttles (scope, key, failures, last_failure_at, locked_until)
+VALUES (sqlc.arg('scope'), sqlc.arg('key'), 1, sqlc.arg('now')::timestamptz, null)
+ON CONFLICT (scope, key) DO UPDATE
+SET failures = CASE
+        WHEN login_throttles.last_failure_at < sqlc.arg('now')::timestamptz - interval '24 hours' THEN 1
+        ELSE login_throttles.failures + 1
+    END,
+    last_failure_at = sqlc.arg('now')::timestamptz
+RETURNING failures;
+
+-- name: LockLogin :exec
+UPDATE login_throttles
+SET locked_until = sqlc.arg('locked_until')::timestamptz
+WHERE scope = sqlc.arg('scope') AND key = sqlc.arg('key');
+
+-- name: ClearLoginThrottle :exec
+DELETE FROM login_throttles
+WHERE scope = $1 AND key = $2;
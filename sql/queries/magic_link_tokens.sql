@@ -0,0 +1,9 @@
+-- name: CreateMagicLinkToken :exec
+INSERT INTO magic_link_tokens (token_hash, created_at, user_id, nonce_hash, expires_at, used_at)
+VALUES ($1, now(), $2, $3, $4, null);
+
+-- name: UseMagicLinkToken :one
+UPDATE magic_link_tokens
+SET used_at = now()
+WHERE token_hash = $1 AND nonce_hash = $2 AND used_at IS NULL AND expires_at > now()
+RETURNING user_id;
@@ -0,0 +1,14 @@
+-- name: CreateChirpMention :exec
+INSERT INTO chirp_mentions (chirp_id, user_id, handle, start_offset, end_offset)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: DeleteChirpMentions :exec
+DELETE FROM chirp_mentions
+WHERE chirp_id = $1;
+
+-- name: GetChirpMentions :many
+SELECT chirp_id, user_id, handle, start_offset, end_offset
+FROM chirp_mentions
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+  AND user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)
+ORDER BY chirp_id, start_offset;
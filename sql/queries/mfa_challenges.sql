@@ -0,0 +1,18 @@
+-- name: CreateMFAChallenge :exec
+INSERT INTO mfa_challenges (token_hash, created_at, user_id, expires_at, attempts)
+VALUES ($1, now(), $2, $3, 0);
+
+-- name: GetMFAChallenge :one
+SELECT token_hash, created_at, user_id, expires_at, attempts
+FROM mfa_challenges
+WHERE token_hash = $1;
+
+-- name: IncrementMFAChallengeAttempts :one
+UPDATE mfa_challenges
+SET attempts = attempts + 1
+WHERE token_hash = $1
+RETURNING attempts;
+
+-- name: DeleteMFAChallenge :exec
+DELETE FROM mfa_challenges
+WHERE token_hash = $1;
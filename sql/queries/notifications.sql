@@ -0,0 +1,11 @@
+-- name: CreateNotification :exec
+INSERT INTO notifications (id, created_at, user_id, actor_id, kind, chirp_id)
+VALUES (gen_random_uuid(), now(), $1, $2, $3, $4)
+ON CONFLICT (user_id, chirp_id, kind) DO NOTHING;
+
+-- name: GetNotifications :many
+SELECT id, created_at, user_id, actor_id, kind, chirp_id, read_at
+FROM notifications
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
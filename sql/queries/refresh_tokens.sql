@@ -1,9 +1,9 @@
 -- name: CreateRefreshToken :exec
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
-VALUES ($1, now(), now(), $2, $3, null);
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip_address, last_used_at)
+VALUES ($1, now(), now(), $2, $3, null, $4, $5, $6, now());
 
 -- name: GetRefreshToken :one
-SELECT token, created_at, updated_at, user_id, expires_at, revoked_at 
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, user_agent, ip_address, last_used_at
 FROM refresh_tokens 
 WHERE token = $1;
 
@@ -15,4 +15,41 @@ WHERE token = $1;
 -- name: GetUserFromRefreshToken :one
 SELECT user_id
 FROM refresh_tokens
-WHERE token = $1;
\ No newline at end of file
+WHERE token = $1;
+
+-- name: RevokeOtherUserSessions :exec
+UPDATE refresh_tokens
+SET revoked_at = now(), updated_at = now()
+WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL;
+
+-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+SET revoked_at = now(), updated_at = now(), replaced_by = $2
+WHERE token = $1 AND replaced_by IS NULL AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = now(), updated_at = now()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: GetUserSessions :many
+SELECT
+    family_id,
+    (SELECT min(f.created_at) FROM refresh_tokens f WHERE f.family_id = refresh_tokens.family_id)::timestamptz AS signed_in_at,
+    last_used_at,
+    user_agent,
+    ip_address,
+    expires_at
+FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()
+ORDER BY last_used_at DESC;
+
+-- name: RevokeUserSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = now(), updated_at = now()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = now(), updated_at = now()
+WHERE user_id = $1 AND revoked_at IS NULL;
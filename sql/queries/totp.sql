@@ -0,0 +1,39 @@
+-- name: UpsertUserTOTP :one
+INSERT INTO user_totp (user_id, created_at, updated_at, secret, enabled_at, last_used_step)
+VALUES ($1, now(), now(), $2, null, 0)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, updated_at = now(), last_used_step = 0
+WHERE user_totp.enabled_at IS NULL
+RETURNING *;
+
+-- name: GetUserTOTP :one
+SELECT user_id, created_at, updated_at, secret, enabled_at, last_used_step
+FROM user_totp
+WHERE user_id = $1;
+
+-- name: EnableUserTOTP :exec
+UPDATE user_totp
+SET enabled_at = now(), updated_at = now()
+WHERE user_id = $1;
+
+-- name: UseTOTPStep :execrows
+UPDATE user_totp
+SET last_used_step = $2, updated_at = now()
+WHERE user_id = $1 AND last_used_step < $2;
+
+-- name: DeleteUserTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO totp_recovery_codes (user_id, code_hash, created_at)
+VALUES ($1, $2, now());
+
+-- name: UseRecoveryCode :execrows
+UPDATE totp_recovery_codes
+SET used_at = now()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM totp_recovery_codes
+WHERE user_id = $1;
@@ -1,23 +1,86 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
-VALUES (gen_random_uuid(), now(), now(), $1, $2)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
+VALUES (gen_random_uuid(), now(), now(), $1, $2, $3)
 RETURNING *;
 
 -- name: DeleteAllUsers :exec
 DELETE FROM users;
 
+-- name: GetUser :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, avatar_url, role, email_verified_at, deleted_at
+FROM users
+WHERE id = $1;
+
 -- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, avatar_url, role, email_verified_at, deleted_at
 FROM users
 WHERE email = $1;
 
+-- name: GetUserByHandle :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, avatar_url, role, email_verified_at, deleted_at
+FROM users
+WHERE lower(handle) = lower(sqlc.arg('handle')) AND deleted_at IS NULL;
+
+-- name: GetUsersByHandles :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, avatar_url, role, email_verified_at, deleted_at
+FROM users
+WHERE lower(handle) = ANY(sqlc.arg('handles')::text[]) AND deleted_at IS NULL;
+
+-- name: IsActiveUser :one
+SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL);
+
 -- name: UpdateUser :one
 UPDATE users
-SET updated_at = now(), email = $2, hashed_password = $3
-WHERE id = $1
+SET updated_at = now(),
+    email = COALESCE(sqlc.narg('email'), email),
+    hashed_password = COALESCE(sqlc.narg('hashed_password'), hashed_password),
+    handle = COALESCE(sqlc.narg('handle'), handle),
+    display_name = COALESCE(sqlc.narg('display_name'), display_name),
+    bio = COALESCE(sqlc.narg('bio'), bio),
+    avatar_url = COALESCE(sqlc.narg('avatar_url'), avatar_url),
+    email_verified_at = CASE
+        WHEN sqlc.narg('email')::text <> email THEN NULL
+        ELSE email_verified_at
+    END
+WHERE id = sqlc.arg('id')
 RETURNING *;
 
 -- name: UpdateUserSubscription :exec
 UPDATE users
 SET updated_at = now(), is_chirpy_red = $2
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: RehashUserPassword :execrows
+UPDATE users
+SET hashed_password = sqlc.arg('new_hash')
+WHERE id = sqlc.arg('id') AND hashed_password = sqlc.arg('old_hash');
+
+-- name: GetPasswordHashStats :one
+SELECT count(*) FILTER (WHERE hashed_password LIKE sqlc.arg('current_prefix')::text || '%') AS current,
+    count(*) FILTER (WHERE hashed_password = 'unset') AS unset,
+    count(*) AS total
+FROM users;
+
+-- name: ScheduleUserDeletion :one
+UPDATE users
+SET deleted_at = COALESCE(deleted_at, now()), updated_at = now()
+WHERE id = $1
+RETURNING deleted_at;
+
+-- name: CancelUserDeletion :exec
+UPDATE users
+SET deleted_at = NULL, updated_at = now()
+WHERE id = $1 AND deleted_at IS NOT NULL;
+
+-- name: PurgeDeletedUsers :execrows
+WITH purged AS (
+    SELECT id
+    FROM users
+    WHERE deleted_at < now() - make_interval(days => sqlc.arg('grace_days')::int)
+), rechirps AS (
+    DELETE FROM chirps
+    WHERE kind = 'rechirp'
+      AND original_id IN (SELECT id FROM chirps WHERE user_id IN (SELECT id FROM purged))
+)
+DELETE FROM users
+WHERE id IN (SELECT id FROM purged);
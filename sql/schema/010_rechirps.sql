@@ -0,0 +1,17 @@
+-- +goose Up
+-- A rechirp is an empty chirp pointing at the original and is removed together
+-- with it. A quote has its own body, so it survives the original being deleted
+-- and is rendered with original_id cleared. The foreign key can't tell the two
+-- apart, so it only clears original_id; whatever deletes chirps, DeleteChirp
+-- and the account purge, deletes their rechirps first.
+ALTER TABLE chirps ADD COLUMN kind TEXT NOT NULL DEFAULT 'chirp' CHECK (kind IN ('chirp', 'rechirp', 'quote'));
+ALTER TABLE chirps ADD COLUMN original_id UUID REFERENCES chirps(id) ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX chirps_user_id_rechirp_idx ON chirps (user_id, original_id) WHERE kind = 'rechirp';
+CREATE INDEX chirps_original_id_idx ON chirps (original_id);
+
+-- +goose Down
+DROP INDEX chirps_original_id_idx;
+DROP INDEX chirps_user_id_rechirp_idx;
+ALTER TABLE chirps DROP COLUMN original_id;
+ALTER TABLE chirps DROP COLUMN kind;
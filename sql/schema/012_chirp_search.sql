@@ -0,0 +1,11 @@
+-- +goose Up
+-- Postgres keeps the document in step with the body on every insert and edit,
+-- and fills it in for existing chirps when the column is added.
+ALTER TABLE chirps ADD COLUMN search_document TSVECTOR
+    GENERATED ALWAYS AS (to_tsvector('english', body)) STORED;
+
+CREATE INDEX chirps_search_document_idx ON chirps USING GIN (search_document);
+
+-- +goose Down
+DROP INDEX chirps_search_document_idx;
+ALTER TABLE chirps DROP COLUMN search_document;
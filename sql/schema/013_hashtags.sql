@@ -0,0 +1,59 @@
+-- +goose Up
+CREATE TABLE hashtags (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    tag TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE chirp_hashtags (
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    hashtag_id UUID NOT NULL REFERENCES hashtags(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (chirp_id, hashtag_id)
+);
+
+CREATE INDEX chirp_hashtags_hashtag_id_idx ON chirp_hashtags (hashtag_id);
+
+-- Hourly usage counters kept in step with chirp_hashtags, so trending tags
+-- are summed over a handful of buckets instead of scanning chirps.
+CREATE TABLE hashtag_usage (
+    hashtag_id UUID NOT NULL REFERENCES hashtags(id) ON DELETE CASCADE,
+    bucket TIMESTAMPTZ NOT NULL,
+    uses INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (hashtag_id, bucket)
+);
+
+CREATE INDEX hashtag_usage_bucket_idx ON hashtag_usage (bucket);
+
+-- Usage follows the links themselves: a tag counts once per chirp in the hour
+-- it was linked, and stops counting once it is edited out of the chirp or the
+-- chirp is deleted.
+-- +goose StatementBegin
+CREATE FUNCTION hashtag_usage_sync() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO hashtag_usage (hashtag_id, bucket, uses)
+        VALUES (NEW.hashtag_id, date_trunc('hour', NEW.created_at), 1)
+        ON CONFLICT (hashtag_id, bucket) DO UPDATE SET uses = hashtag_usage.uses + 1;
+    ELSE
+        UPDATE hashtag_usage
+        SET uses = uses - 1
+        WHERE hashtag_id = OLD.hashtag_id
+          AND bucket = date_trunc('hour', OLD.created_at)
+          AND uses > 0;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER hashtag_usage_sync
+AFTER INSERT OR DELETE ON chirp_hashtags
+FOR EACH ROW EXECUTE FUNCTION hashtag_usage_sync();
+
+-- +goose Down
+DROP TRIGGER hashtag_usage_sync ON chirp_hashtags;
+DROP FUNCTION hashtag_usage_sync;
+DROP TABLE hashtag_usage;
+DROP TABLE chirp_hashtags;
+DROP TABLE hashtags;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Failed logins are counted per account (scope 'account', key is the lower
+-- cased email) and per client address (scope 'ip'), in the database so every
+-- replica sees the same counts. A count starts over once a day has passed
+-- since its last failure.
+CREATE TABLE login_throttles (
+    scope TEXT NOT NULL CHECK (scope IN ('account', 'ip')),
+    key TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ,
+    PRIMARY KEY (scope, key)
+);
+
+-- +goose Down
+DROP TABLE login_throttles;
@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE password_reset_tokens (
+    token_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX password_reset_tokens_user_id_idx ON password_reset_tokens (user_id);
+
+-- When an email of each kind was last sent to an address, so the endpoints
+-- that mail links can be throttled per address. Rows are keyed on what the
+-- client typed, lower cased, whether or not it belongs to an account, so a
+-- throttled response says nothing about which addresses are registered.
+CREATE TABLE email_cooldowns (
+    kind TEXT NOT NULL,
+    email TEXT NOT NULL,
+    sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (kind, email)
+);
+
+-- +goose Down
+DROP TABLE email_cooldowns;
+DROP TABLE password_reset_tokens;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- nonce_hash ties a link to the client that asked for it, so a link that
+-- leaks from the mailbox cannot be redeemed anywhere else.
+CREATE TABLE magic_link_tokens (
+    token_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    nonce_hash TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX magic_link_tokens_user_id_idx ON magic_link_tokens (user_id);
+
+-- +goose Down
+DROP TABLE magic_link_tokens;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- A set deleted_at hides the account and its content until it is either
+-- cancelled by logging in or purged, at which point ON DELETE CASCADE removes
+-- everything that belongs to it.
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX users_deleted_at_idx;
+ALTER TABLE users DROP COLUMN deleted_at;
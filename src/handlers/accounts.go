@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// accountDeletionGraceDays is how long a deleted account can still be
+// restored by logging in before it is purged for good.
+const accountDeletionGraceDays = 30
+
+// DeleteCurrentUser hides the account and its chirps and signs it out
+// everywhere. Nothing is removed until RunAccountPurge runs after the grace
+// period, and logging in before then cancels the deletion.
+func (cfg *ApiConfig) DeleteCurrentUser(w http.ResponseWriter, r *http.Request) {
+	jwtUserId := currentUserId(r)
+
+	deletedAt, err := cfg.DbQueries.ScheduleUserDeletion(r.Context(), jwtUserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeUnauthorized(w, "")
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error scheduling user deletion: %s", err))
+		return
+	}
+
+	err = cfg.DbQueries.RevokeUserRefreshTokens(r.Context(), jwtUserId)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error revoking refresh tokens: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusAccepted)
+	res, err := json.Marshal(accountDeletionResponse{
+		DeletedAt: deletedAt.Time.Format(time.RFC3339),
+		PurgeAt:   deletedAt.Time.AddDate(0, 0, accountDeletionGraceDays).Format(time.RFC3339),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
+
+// RunAccountPurge deletes accounts whose grace period has run out, once at
+// start and then every interval, until ctx is done. Their chirps, tokens and
+// everything else go with them through ON DELETE CASCADE.
+func (cfg *ApiConfig) RunAccountPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := cfg.DbQueries.PurgeDeletedUsers(ctx, accountDeletionGraceDays)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error purging deleted users: %s", err))
+		} else if purged > 0 {
+			fmt.Printf("Purged %d deleted accounts\n", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 )
@@ -38,3 +39,30 @@ func (cfg *ApiConfig) ResetMetrics(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	cfg.FileServerHits.Store(0)
 }
+
+// ServePasswordMetrics shows how far the move to the current Argon2id
+// parameters has got.
+func (cfg *ApiConfig) ServePasswordMetrics(w http.ResponseWriter, r *http.Request) {
+	stats, err := cfg.DbQueries.GetPasswordHashStats(r.Context(), cfg.Passwords.HashPrefix())
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting password hash stats: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	res, err := json.Marshal(passwordMetricsResponse{
+		Current:  stats.Current,
+		Outdated: stats.Total - stats.Current - stats.Unset,
+		Unset:    stats.Unset,
+		Rehashed: cfg.PwdRehashes.Load(),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
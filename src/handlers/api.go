@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/FerMusicComposer/chirpy/internal/auth"
 	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/google/uuid"
 )
 
 func GetHealthz(w http.ResponseWriter, r *http.Request) {
@@ -18,6 +20,22 @@ func GetHealthz(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
+// GetJWKS publishes the public keys other services need to verify our tokens.
+// It is safe to cache for a few minutes since new keys are added well before
+// they start signing.
+func (cfg *ApiConfig) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	res, err := json.Marshal(cfg.JWTKeys.JWKS())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
+
 func (cfg *ApiConfig) Login(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	req := loginRequest{}
@@ -32,9 +50,27 @@ func (cfg *ApiConfig) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	accountKey := loginAccountKey(req.Email)
+	ip := cfg.clientIP(r)
+
+	retryAfter, err := cfg.loginRetryAfter(r.Context(), accountKey, ip)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error checking login lockout: %s", err))
+		return
+	}
+
+	if retryAfter > 0 {
+		writeTooManyLoginAttempts(w, retryAfter)
+		return
+	}
+
 	user, err := cfg.DbQueries.GetUserByEmail(r.Context(), req.Email)
 	if err != nil {
+		// Unknown emails count too, so lockouts do not reveal which
+		// accounts exist.
 		if err == sql.ErrNoRows {
+			cfg.recordLoginFailure(r.Context(), accountKey, ip)
 			handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
@@ -44,7 +80,7 @@ func (cfg *ApiConfig) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	matched, err := auth.CheckPasswordHash(req.Password, user.HashedPassword)
+	matched, err := cfg.Passwords.Check(req.Password, user.HashedPassword)
 	if err != nil {
 		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
 		fmt.Println(fmt.Errorf("error checking password: %s", err))
@@ -52,32 +88,62 @@ func (cfg *ApiConfig) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !matched {
+		cfg.recordLoginFailure(r.Context(), accountKey, ip)
 		handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	token, err := auth.MakeJWT(user.ID, cfg.JWTSecret, time.Hour)
-	if err != nil {
+	cfg.upgradePasswordHash(r.Context(), user, req.Password)
+
+	cfg.continueLogin(w, r, user)
+}
+
+// continueLogin runs once the user has passed their first factor, asking for
+// a TOTP code if they have one set up.
+func (cfg *ApiConfig) continueLogin(w http.ResponseWriter, r *http.Request, user database.User) {
+	totp, err := cfg.DbQueries.GetUserTOTP(r.Context(), user.ID)
+	if err != nil && err != sql.ErrNoRows {
 		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
-		fmt.Println(fmt.Errorf("error generating JWT: %s", err))
+		fmt.Println(fmt.Errorf("error getting totp: %s", err))
+		return
+	}
+
+	if err == nil && totp.EnabledAt.Valid {
+		cfg.startMFAChallenge(w, r, user.ID)
 		return
 	}
 
-	refresToken, err := auth.MakeRefreshToken()
+	cfg.completeLogin(w, r, user)
+}
+
+// completeLogin hands out the access and refresh tokens once the user has
+// passed every factor they have set up.
+func (cfg *ApiConfig) completeLogin(w http.ResponseWriter, r *http.Request, user database.User) {
+	cfg.clearLoginFailures(r.Context(), loginAccountKey(user.Email))
+
+	// Logging in is how a user takes back a pending account deletion.
+	if user.DeletedAt.Valid {
+		err := cfg.DbQueries.CancelUserDeletion(r.Context(), user.ID)
+		if err != nil {
+			handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+			fmt.Println(fmt.Errorf("error cancelling user deletion: %s", err))
+			return
+		}
+		user.DeletedAt = sql.NullTime{}
+	}
+
+	sessionId := uuid.New()
+	token, err := cfg.makeAccessToken(user, sessionId)
 	if err != nil {
 		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
-		fmt.Println(fmt.Errorf("error generating refresh token: %s", err))
+		fmt.Println(fmt.Errorf("error generating JWT: %s", err))
 		return
 	}
 
-	err = cfg.DbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     refresToken,
-		UserID:    user.ID,
-		ExpiresAt: time.Now().AddDate(0, 0, 60),
-	})
+	refresToken, err := cfg.issueRefreshToken(r, user.ID, sessionId)
 	if err != nil {
 		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
-		fmt.Println(fmt.Errorf("error inserting refresh token on DB: %s", err))
+		fmt.Println(fmt.Errorf("error issuing refresh token: %s", err))
 		return
 	}
 
@@ -85,15 +151,7 @@ func (cfg *ApiConfig) Login(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Cache-Control", "no-cache")
 	w.WriteHeader(http.StatusOK)
 	res, err := json.Marshal(loginResponse{
-		userData: userData{
-			baseModel: baseModel{
-				ID:        user.ID.String(),
-				CreatedAt: user.CreatedAt.Format(time.RFC3339),
-				UpdatedAt: user.UpdatedAt.Format(time.RFC3339),
-			},
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+		userData:     newUserData(user),
 		Token:        token,
 		RefreshToken: refresToken,
 	})
@@ -108,33 +166,81 @@ func (cfg *ApiConfig) Login(w http.ResponseWriter, r *http.Request) {
 func (cfg *ApiConfig) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		handleRequestErrors(w, err.Error(), http.StatusBadRequest)
+		writeUnauthorized(w, "")
 		fmt.Println(fmt.Errorf("error obtaining bearer: %s", err))
 		return
 	}
 
-	if token == "" {
+	existingToken, err := cfg.DbQueries.GetRefreshToken(r.Context(), token)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error obtaining refresh token: %s", err))
+		return
+	}
+
+	// A token that has already been rotated should never come back. If it
+	// does, someone else holds a copy, so the whole family is revoked.
+	if existingToken.ReplacedBy.Valid {
+		cfg.revokeRefreshTokenFamily(r.Context(), existingToken.FamilyID)
 		handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	existingToken, err := cfg.DbQueries.GetRefreshToken(r.Context(), token)
+	if existingToken.ExpiresAt.Before(cfg.Clock.Now()) || existingToken.RevokedAt.Valid {
+		handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// The role is read again so a promotion or demotion applies on the next
+	// refresh rather than when the session ends.
+	user, err := cfg.DbQueries.GetUser(r.Context(), existingToken.UserID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
 		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
-		fmt.Println(fmt.Errorf("error obtaining refresh token: %s", err))
+		fmt.Println(fmt.Errorf("error getting user: %s", err))
 		return
 	}
 
-	if existingToken.ExpiresAt.Before(time.Now()) || existingToken.RevokedAt.Valid {
+	// Deleting an account revokes its refresh tokens, but one issued in a
+	// race with the deletion must not keep the account alive. Logging in
+	// again is the way to cancel a deletion.
+	if user.DeletedAt.Valid {
 		handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	newJwt, err := auth.MakeJWT(existingToken.UserID, cfg.JWTSecret, time.Hour)
+	newRefreshToken, err := cfg.issueRefreshToken(r, existingToken.UserID, existingToken.FamilyID)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error issuing refresh token: %s", err))
+		return
+	}
+
+	rotated, err := cfg.DbQueries.RotateRefreshToken(r.Context(), database.RotateRefreshTokenParams{
+		Token:      token,
+		ReplacedBy: sql.NullString{String: newRefreshToken, Valid: true},
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error rotating refresh token: %s", err))
+		return
+	}
+
+	// Another request rotated the same token between our read and update.
+	if rotated == 0 {
+		cfg.revokeRefreshTokenFamily(r.Context(), existingToken.FamilyID)
+		handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	newJwt, err := cfg.makeAccessToken(user, existingToken.FamilyID)
 	if err != nil {
 		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
 		fmt.Println(fmt.Errorf("error generating JWT: %s", err))
@@ -145,7 +251,8 @@ func (cfg *ApiConfig) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Cache-Control", "no-cache")
 	w.WriteHeader(http.StatusOK)
 	res, err := json.Marshal(refreshTokenResponse{
-		Token: newJwt,
+		Token:        newJwt,
+		RefreshToken: newRefreshToken,
 	})
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -158,16 +265,11 @@ func (cfg *ApiConfig) RefreshToken(w http.ResponseWriter, r *http.Request) {
 func (cfg *ApiConfig) RevokeToken(w http.ResponseWriter, r *http.Request) {
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		handleRequestErrors(w, err.Error(), http.StatusBadRequest)
+		writeUnauthorized(w, "")
 		fmt.Println(fmt.Errorf("error obtaining bearer: %s", err))
 		return
 	}
 
-	if token == "" {
-		handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	err = cfg.DbQueries.RevokeRefreshToken(r.Context(), token)
 	if err != nil {
 		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
@@ -177,3 +279,42 @@ func (cfg *ApiConfig) RevokeToken(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// makeAccessToken issues a one hour access token carrying the user's role,
+// every scope a logged in user has and the session it belongs to.
+func (cfg *ApiConfig) makeAccessToken(user database.User, sessionId uuid.UUID) (string, error) {
+	claims := auth.NewAccessClaims(user.ID, user.Role, auth.DefaultScopes, time.Hour)
+	claims.SessionID = sessionId.String()
+	return cfg.JWTKeys.Sign(claims)
+}
+
+// issueRefreshToken stores a new refresh token in the given family. Login starts
+// a new family; refreshing keeps the family of the token being rotated. The
+// family doubles as the session, tagged with the device making the request.
+func (cfg *ApiConfig) issueRefreshToken(r *http.Request, userId, familyId uuid.UUID) (string, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = cfg.DbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:     token,
+		UserID:    userId,
+		ExpiresAt: cfg.Clock.Now().AddDate(0, 0, 60),
+		FamilyID:  familyId,
+		UserAgent: r.UserAgent(),
+		IpAddress: cfg.clientIP(r),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (cfg *ApiConfig) revokeRefreshTokenFamily(ctx context.Context, familyId uuid.UUID) {
+	err := cfg.DbQueries.RevokeRefreshTokenFamily(ctx, familyId)
+	if err != nil {
+		fmt.Println(fmt.Errorf("error revoking refresh token family: %s", err))
+	}
+}
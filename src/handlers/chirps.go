@@ -1,14 +1,13 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"sort"
 	"time"
 
-	"github.com/FerMusicComposer/chirpy/internal/auth"
 	"github.com/FerMusicComposer/chirpy/internal/database"
 	"github.com/google/uuid"
 )
@@ -30,23 +29,65 @@ func (cfg *ApiConfig) CreateChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		handleRequestErrors(w, err.Error(), http.StatusBadRequest)
-		fmt.Println(fmt.Errorf("error obtaining bearer: %s", err))
+	if !cfg.requireVerifiedEmail(w, r) {
 		return
 	}
 
-	jwtUserId, err := auth.ValidateJWT(token, cfg.JWTSecret)
-	if err != nil {
-		handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
-		fmt.Println(fmt.Errorf("error validating jwt: %s", err))
-		return
+	jwtUserId := currentUserId(r)
+
+	parentId := uuid.NullUUID{}
+	if newChirp.InReplyTo != "" {
+		parentId.UUID, err = uuid.Parse(newChirp.InReplyTo)
+		if err != nil {
+			handleRequestErrors(w, "in_reply_to is invalid", http.StatusBadRequest)
+			return
+		}
+		parentId.Valid = true
+
+		_, err = cfg.DbQueries.GetChirp(r.Context(), parentId.UUID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				handleRequestErrors(w, "in_reply_to chirp not found", http.StatusBadRequest)
+				return
+			}
+
+			handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+			fmt.Println(fmt.Errorf("error getting parent chirp: %s", err))
+			return
+		}
+	}
+
+	kind := chirpKindChirp
+	originalId := uuid.NullUUID{}
+	if newChirp.QuotedChirpID != "" {
+		quotedId, err := uuid.Parse(newChirp.QuotedChirpID)
+		if err != nil {
+			handleRequestErrors(w, "quoted_chirp_id is invalid", http.StatusBadRequest)
+			return
+		}
+
+		quoted, err := cfg.DbQueries.GetChirp(r.Context(), quotedId)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				handleRequestErrors(w, "quoted chirp not found", http.StatusBadRequest)
+				return
+			}
+
+			handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+			fmt.Println(fmt.Errorf("error getting quoted chirp: %s", err))
+			return
+		}
+
+		kind = chirpKindQuote
+		originalId = rootChirpId(quoted)
 	}
 
 	chirp, err := cfg.DbQueries.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   newChirp.Body,
-		UserID: jwtUserId,
+		Body:       newChirp.Body,
+		UserID:     jwtUserId,
+		ParentID:   parentId,
+		Kind:       kind,
+		OriginalID: originalId,
 	})
 	if err != nil {
 		handleRequestErrors(w, "error creating chirp", http.StatusInternalServerError)
@@ -54,20 +95,29 @@ func (cfg *ApiConfig) CreateChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The chirp is already stored at this point, so a failure to index its tags
+	// and mentions is logged rather than failing the request.
+	err = cfg.storeHashtags(r.Context(), chirp.ID, chirp.Body)
+	if err != nil {
+		fmt.Println(fmt.Errorf("error storing hashtags: %s", err))
+	}
+
+	err = cfg.storeMentions(r.Context(), chirp)
+	if err != nil {
+		fmt.Println(fmt.Errorf("error storing mentions: %s", err))
+	}
+
+	resp, err := cfg.chirpResponses(r.Context(), uuid.NullUUID{UUID: jwtUserId, Valid: true}, []database.Chirp{chirp})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error building chirp response: %s", err))
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.WriteHeader(http.StatusCreated)
-	res, err := json.Marshal(createChirpResponse{
-		baseModel: baseModel{
-			ID:        chirp.ID.String(),
-			CreatedAt: chirp.CreatedAt.Format(time.RFC3339),
-			UpdatedAt: chirp.UpdatedAt.Format(time.RFC3339),
-		},
-		chirpData: chirpData{
-			Body:   chirp.Body,
-			UserID: chirp.UserID.String(),
-		},
-	})
+	res, err := json.Marshal(resp[0])
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Println(err)
@@ -77,48 +127,113 @@ func (cfg *ApiConfig) CreateChirp(w http.ResponseWriter, r *http.Request) {
 }
 
 func (cfg *ApiConfig) GetChirps(w http.ResponseWriter, r *http.Request) {
-	var chirps []database.Chirp
-	var err error
+	page, err := parsePageParams(r, false)
+	if err != nil {
+		handleRequestErrors(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	userId := r.URL.Query().Get("author_id")
-	sortBy := r.URL.Query().Get("sort")
+	authorId := uuid.NullUUID{}
+	if userId := r.URL.Query().Get("author_id"); userId != "" {
+		authorId.UUID, err = uuid.Parse(userId)
+		if err != nil {
+			handleRequestErrors(w, "author_id is invalid", http.StatusBadRequest)
+			return
+		}
+		authorId.Valid = true
+	}
 
-	if userId != "" {
-		chirps, err = cfg.DbQueries.GetChirpsByAuthor(r.Context(), uuid.MustParse(userId))
+	var chirps []database.Chirp
+	cursorCreatedAt, cursorId := page.cursorArgs()
+
+	if page.scanDesc() {
+		chirps, err = cfg.DbQueries.GetChirpsPageDesc(r.Context(), database.GetChirpsPageDescParams{
+			AuthorID:        authorId,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			PageLimit:       page.fetchLimit(),
+		})
 	} else {
-		chirps, err = cfg.DbQueries.GetAllChirps(r.Context())
+		chirps, err = cfg.DbQueries.GetChirpsPageAsc(r.Context(), database.GetChirpsPageAscParams{
+			AuthorID:        authorId,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			PageLimit:       page.fetchLimit(),
+		})
 	}
 
 	if err != nil {
-		handleRequestErrors(w, err.Error(), http.StatusInternalServerError)
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
 		fmt.Println(fmt.Errorf("error getting chirps: %s", err))
 		return
 	}
 
-	if sortBy == "desc" {
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].CreatedAt.After(chirps[j].CreatedAt)
+	cfg.writeChirpsPage(w, r, chirps, page)
+}
+
+func (cfg *ApiConfig) GetTimeline(w http.ResponseWriter, r *http.Request) {
+	jwtUserId := currentUserId(r)
+
+	page, err := parsePageParams(r, true)
+	if err != nil {
+		handleRequestErrors(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var chirps []database.Chirp
+	cursorCreatedAt, cursorId := page.cursorArgs()
+
+	if page.scanDesc() {
+		chirps, err = cfg.DbQueries.GetTimelinePageDesc(r.Context(), database.GetTimelinePageDescParams{
+			FollowerID:      jwtUserId,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			PageLimit:       page.fetchLimit(),
+		})
+	} else {
+		chirps, err = cfg.DbQueries.GetTimelinePageAsc(r.Context(), database.GetTimelinePageAscParams{
+			FollowerID:      jwtUserId,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			PageLimit:       page.fetchLimit(),
 		})
 	}
-	
-	resp := make([]createChirpResponse, len(chirps))
-	for i, chirp := range chirps {
-		resp[i] = createChirpResponse{
-			baseModel: baseModel{
-				ID:        chirp.ID.String(),
-				CreatedAt: chirp.CreatedAt.Format(time.RFC3339),
-				UpdatedAt: chirp.UpdatedAt.Format(time.RFC3339),
-			},
-			chirpData: chirpData{
-				Body:   chirp.Body,
-				UserID: chirp.UserID.String(),
-			}}
+
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting timeline: %s", err))
+		return
+	}
+
+	cfg.writeChirpsPage(w, r, chirps, page)
+}
+
+func (cfg *ApiConfig) GetChirp(w http.ResponseWriter, r *http.Request) {
+	chirpId := r.PathValue("id")
+
+	chirp, err := cfg.DbQueries.GetChirp(r.Context(), uuid.MustParse(chirpId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "chirp not found", http.StatusNotFound)
+			return
+		}
+
+		handleRequestErrors(w, err.Error(), http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting chirp: %s", err))
+		return
+	}
+
+	resp, err := cfg.chirpResponses(r.Context(), optionalUserId(r), []database.Chirp{chirp})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error building chirp response: %s", err))
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.WriteHeader(http.StatusOK)
-	res, err := json.Marshal(resp)
+	res, err := json.Marshal(resp[0])
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Println(err)
@@ -127,35 +242,90 @@ func (cfg *ApiConfig) GetChirps(w http.ResponseWriter, r *http.Request) {
 	w.Write(res)
 }
 
-func (cfg *ApiConfig) GetChirp(w http.ResponseWriter, r *http.Request) {
-	chirpId := r.PathValue("id")
+// UpdateChirp replaces the body of a chirp owned by the caller. The previous
+// body is kept as a revision in the same statement.
+func (cfg *ApiConfig) UpdateChirp(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		handleRequestErrors(w, "chirp id is invalid", http.StatusBadRequest)
+		return
+	}
 
-	chirp, err := cfg.DbQueries.GetChirp(r.Context(), uuid.MustParse(chirpId))
+	decoder := json.NewDecoder(r.Body)
+	req := updateChirpRequest{}
+	err = decoder.Decode(&req)
+	if err != nil {
+		handleRequestErrors(w, "invalid json", http.StatusBadRequest)
+		fmt.Println(fmt.Errorf("error decoding json: %s", err))
+		return
+	}
+
+	req.Body, err = validateChirp(req.Body)
+	if err != nil {
+		handleRequestErrors(w, err.Error(), http.StatusBadRequest)
+		fmt.Println(fmt.Errorf("error validating chirp: %s", err))
+		return
+	}
+
+	if !cfg.requireVerifiedEmail(w, r) {
+		return
+	}
+
+	jwtUserId := currentUserId(r)
+
+	chirp, err := cfg.DbQueries.GetChirp(r.Context(), chirpId)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			handleRequestErrors(w, "chirp not found", http.StatusNotFound)
 			return
 		}
 
-		handleRequestErrors(w, err.Error(), http.StatusInternalServerError)
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
 		fmt.Println(fmt.Errorf("error getting chirp: %s", err))
 		return
 	}
 
+	if chirp.UserID != jwtUserId {
+		handleRequestErrors(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	if chirp.Kind == chirpKindRechirp {
+		handleRequestErrors(w, "rechirps cannot be edited", http.StatusBadRequest)
+		return
+	}
+
+	chirp, err = cfg.DbQueries.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+		ID:   chirpId,
+		Body: req.Body,
+	})
+	if err != nil {
+		handleRequestErrors(w, "error updating chirp", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error updating chirp: %s", err))
+		return
+	}
+
+	err = cfg.storeHashtags(r.Context(), chirp.ID, chirp.Body)
+	if err != nil {
+		fmt.Println(fmt.Errorf("error storing hashtags: %s", err))
+	}
+
+	err = cfg.storeMentions(r.Context(), chirp)
+	if err != nil {
+		fmt.Println(fmt.Errorf("error storing mentions: %s", err))
+	}
+
+	resp, err := cfg.chirpResponses(r.Context(), uuid.NullUUID{UUID: jwtUserId, Valid: true}, []database.Chirp{chirp})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error building chirp response: %s", err))
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.WriteHeader(http.StatusOK)
-	res, err := json.Marshal(createChirpResponse{
-		baseModel: baseModel{
-			ID:        chirp.ID.String(),
-			CreatedAt: chirp.CreatedAt.Format(time.RFC3339),
-			UpdatedAt: chirp.UpdatedAt.Format(time.RFC3339),
-		},
-		chirpData: chirpData{
-			Body:   chirp.Body,
-			UserID: chirp.UserID.String(),
-		},
-	})
+	res, err := json.Marshal(resp[0])
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Println(err)
@@ -164,23 +334,61 @@ func (cfg *ApiConfig) GetChirp(w http.ResponseWriter, r *http.Request) {
 	w.Write(res)
 }
 
-func (cfg *ApiConfig) DeleteChirp(w http.ResponseWriter, r *http.Request) {
-	chirpId := r.PathValue("id")
+func (cfg *ApiConfig) GetChirpRevisions(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		handleRequestErrors(w, "chirp id is invalid", http.StatusBadRequest)
+		return
+	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	_, err = cfg.DbQueries.GetChirp(r.Context(), chirpId)
 	if err != nil {
-		handleRequestErrors(w, err.Error(), http.StatusUnauthorized)
-		fmt.Println(fmt.Errorf("error obtaining bearer: %s", err))
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "chirp not found", http.StatusNotFound)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting chirp: %s", err))
 		return
 	}
 
-	jwtUserId, err := auth.ValidateJWT(token, cfg.JWTSecret)
+	revisions, err := cfg.DbQueries.GetChirpRevisions(r.Context(), chirpId)
 	if err != nil {
-		handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
-		fmt.Println(fmt.Errorf("error validating jwt: %s", err))
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting chirp revisions: %s", err))
 		return
 	}
 
+	resp := make([]chirpRevisionResponse, len(revisions))
+	for i, revision := range revisions {
+		resp[i] = chirpRevisionResponse{
+			ID:        revision.ID.String(),
+			Body:      revision.Body,
+			CreatedAt: revision.CreatedAt.Format(time.RFC3339),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	res, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
+
+// DeleteChirp removes a chirp owned by the caller together with its rechirps.
+// Replies to it are kept and become top-level chirps, since their in_reply_to
+// is cleared by the database; quotes are kept and show the original as deleted.
+func (cfg *ApiConfig) DeleteChirp(w http.ResponseWriter, r *http.Request) {
+	chirpId := r.PathValue("id")
+
+	jwtUserId := currentUserId(r)
+
 	chirp, err := cfg.DbQueries.GetChirp(r.Context(), uuid.MustParse(chirpId))
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -207,3 +415,136 @@ func (cfg *ApiConfig) DeleteChirp(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func newChirpResponse(chirp database.Chirp) createChirpResponse {
+	inReplyTo := ""
+	if chirp.ParentID.Valid {
+		inReplyTo = chirp.ParentID.UUID.String()
+	}
+
+	return createChirpResponse{
+		baseModel: baseModel{
+			ID:        chirp.ID.String(),
+			CreatedAt: chirp.CreatedAt.Format(time.RFC3339),
+			UpdatedAt: chirp.UpdatedAt.Format(time.RFC3339),
+		},
+		chirpData: chirpData{
+			Body:      chirp.Body,
+			UserID:    chirp.UserID.String(),
+			InReplyTo: inReplyTo,
+		},
+		LikeCount: chirp.LikeCount,
+		Kind:      chirp.Kind,
+		Edited:    chirp.EditedAt.Valid,
+		Mentions:  []mentionEntity{},
+	}
+}
+
+// chirpResponses converts chirps for a response, embeds the chirps that
+// rechirps and quotes point at, and fills in mentions and the fields that
+// depend on who is asking. Each of those is a single query for the whole batch.
+func (cfg *ApiConfig) chirpResponses(ctx context.Context, viewerId uuid.NullUUID, chirps []database.Chirp) ([]createChirpResponse, error) {
+	resp := make([]createChirpResponse, len(chirps))
+	if len(chirps) == 0 {
+		return resp, nil
+	}
+
+	// byId covers the requested chirps and the originals embedded in them, so
+	// mentions and likes are filled in for both.
+	byId := map[uuid.UUID][]*createChirpResponse{}
+	originalIds := []uuid.UUID{}
+	for i, chirp := range chirps {
+		resp[i] = newChirpResponse(chirp)
+		byId[chirp.ID] = append(byId[chirp.ID], &resp[i])
+		if chirp.OriginalID.Valid {
+			originalIds = append(originalIds, chirp.OriginalID.UUID)
+		}
+	}
+
+	originals := map[uuid.UUID]*createChirpResponse{}
+	if len(originalIds) > 0 {
+		rows, err := cfg.DbQueries.GetChirpsByIDs(ctx, originalIds)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			original := newChirpResponse(row)
+			originals[row.ID] = &original
+			byId[row.ID] = append(byId[row.ID], &original)
+		}
+	}
+
+	for i, chirp := range chirps {
+		if chirp.Kind == chirpKindChirp {
+			continue
+		}
+		// The original is gone either because it was deleted before we got
+		// here or, for quotes, because DeleteChirp cleared original_id.
+		resp[i].Original = originals[chirp.OriginalID.UUID]
+		resp[i].OriginalDeleted = resp[i].Original == nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(byId))
+	for id := range byId {
+		ids = append(ids, id)
+	}
+
+	mentions, err := cfg.DbQueries.GetChirpMentions(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mention := range mentions {
+		for _, chirp := range byId[mention.ChirpID] {
+			chirp.Mentions = append(chirp.Mentions, mentionEntity{
+				UserID: mention.UserID.String(),
+				Handle: mention.Handle,
+				Start:  mention.StartOffset,
+				End:    mention.EndOffset,
+			})
+		}
+	}
+
+	if !viewerId.Valid {
+		return resp, nil
+	}
+
+	likedIds, err := cfg.DbQueries.GetLikedChirpIDs(ctx, database.GetLikedChirpIDsParams{
+		UserID:   viewerId.UUID,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range likedIds {
+		for _, chirp := range byId[id] {
+			chirp.LikedByMe = true
+		}
+	}
+
+	return resp, nil
+}
+
+func (cfg *ApiConfig) writeChirpsPage(w http.ResponseWriter, r *http.Request, chirps []database.Chirp, page pageParams) {
+	chirps, next, prev := paginate(chirps, page, chirpCursor)
+
+	resp, err := cfg.chirpResponses(r.Context(), optionalUserId(r), chirps)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error building chirps response: %s", err))
+		return
+	}
+
+	setPaginationHeaders(w, r, next, prev)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	res, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *ApiConfig) FollowUser(w http.ResponseWriter, r *http.Request) {
+	followeeId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		handleRequestErrors(w, "user id is invalid", http.StatusBadRequest)
+		return
+	}
+
+	if !cfg.requireVerifiedEmail(w, r) {
+		return
+	}
+
+	jwtUserId := currentUserId(r)
+
+	if followeeId == jwtUserId {
+		handleRequestErrors(w, "you cannot follow yourself", http.StatusBadRequest)
+		return
+	}
+
+	followee, err := cfg.DbQueries.GetUser(r.Context(), followeeId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting user: %s", err))
+		return
+	}
+
+	// Accounts pending deletion are hidden everywhere else, so they can't be
+	// followed either.
+	if followee.DeletedAt.Valid {
+		handleRequestErrors(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	err = cfg.DbQueries.CreateFollow(r.Context(), database.CreateFollowParams{
+		FollowerID: jwtUserId,
+		FolloweeID: followeeId,
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error creating follow: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *ApiConfig) UnfollowUser(w http.ResponseWriter, r *http.Request) {
+	followeeId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		handleRequestErrors(w, "user id is invalid", http.StatusBadRequest)
+		return
+	}
+
+	jwtUserId := currentUserId(r)
+
+	err = cfg.DbQueries.DeleteFollow(r.Context(), database.DeleteFollowParams{
+		FollowerID: jwtUserId,
+		FolloweeID: followeeId,
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error deleting follow: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *ApiConfig) GetFollowers(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		handleRequestErrors(w, "user id is invalid", http.StatusBadRequest)
+		return
+	}
+
+	page, err := parsePageParams(r, true)
+	if err != nil {
+		handleRequestErrors(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var follows []database.Follow
+	cursorCreatedAt, cursorId := page.cursorArgs()
+
+	if page.scanDesc() {
+		follows, err = cfg.DbQueries.GetFollowersPageDesc(r.Context(), database.GetFollowersPageDescParams{
+			FolloweeID:      userId,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			PageLimit:       page.fetchLimit(),
+		})
+	} else {
+		follows, err = cfg.DbQueries.GetFollowersPageAsc(r.Context(), database.GetFollowersPageAscParams{
+			FolloweeID:      userId,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			PageLimit:       page.fetchLimit(),
+		})
+	}
+
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting followers: %s", err))
+		return
+	}
+
+	follows, next, prev := paginate(follows, page, followerCursor)
+
+	resp := make([]followResponse, len(follows))
+	for i, follow := range follows {
+		resp[i] = followResponse{
+			UserID:     follow.FollowerID.String(),
+			FollowedAt: follow.CreatedAt.Format(time.RFC3339),
+		}
+	}
+
+	setPaginationHeaders(w, r, next, prev)
+	writeFollows(w, resp)
+}
+
+func (cfg *ApiConfig) GetFollowing(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		handleRequestErrors(w, "user id is invalid", http.StatusBadRequest)
+		return
+	}
+
+	page, err := parsePageParams(r, true)
+	if err != nil {
+		handleRequestErrors(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var follows []database.Follow
+	cursorCreatedAt, cursorId := page.cursorArgs()
+
+	if page.scanDesc() {
+		follows, err = cfg.DbQueries.GetFollowingPageDesc(r.Context(), database.GetFollowingPageDescParams{
+			FollowerID:      userId,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			PageLimit:       page.fetchLimit(),
+		})
+	} else {
+		follows, err = cfg.DbQueries.GetFollowingPageAsc(r.Context(), database.GetFollowingPageAscParams{
+			FollowerID:      userId,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			PageLimit:       page.fetchLimit(),
+		})
+	}
+
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting following: %s", err))
+		return
+	}
+
+	follows, next, prev := paginate(follows, page, followeeCursor)
+
+	resp := make([]followResponse, len(follows))
+	for i, follow := range follows {
+		resp[i] = followResponse{
+			UserID:     follow.FolloweeID.String(),
+			FollowedAt: follow.CreatedAt.Format(time.RFC3339),
+		}
+	}
+
+	setPaginationHeaders(w, r, next, prev)
+	writeFollows(w, resp)
+}
+
+// followerCursor and followeeCursor key a page on when the follow happened,
+// broken by the id of the user listed.
+func followerCursor(follow database.Follow) pageCursor {
+	return pageCursor{CreatedAt: follow.CreatedAt, ID: follow.FollowerID}
+}
+
+func followeeCursor(follow database.Follow) pageCursor {
+	return pageCursor{CreatedAt: follow.CreatedAt, ID: follow.FolloweeID}
+}
+
+func writeFollows(w http.ResponseWriter, resp []followResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	res, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultTrendingWindow = 24 * time.Hour
+	maxTrendingWindow     = 7 * 24 * time.Hour
+	defaultTrendingLimit  = 10
+)
+
+// storeHashtags links a chirp to the tags in its body and drops links to tags
+// it no longer mentions. Trending usage is kept in step with the links by a
+// trigger, so editing a chirp doesn't inflate it.
+func (cfg *ApiConfig) storeHashtags(ctx context.Context, chirpId uuid.UUID, body string) error {
+	tags := extractHashtags(body)
+
+	err := cfg.DbQueries.DeleteStaleChirpHashtags(ctx, database.DeleteStaleChirpHashtagsParams{
+		ChirpID: chirpId,
+		Tags:    tags,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		hashtag, err := cfg.DbQueries.UpsertHashtag(ctx, tag)
+		if err != nil {
+			return err
+		}
+
+		err = cfg.DbQueries.CreateChirpHashtag(ctx, database.CreateChirpHashtagParams{
+			ChirpID:   chirpId,
+			HashtagID: hashtag.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cfg *ApiConfig) GetHashtagChirps(w http.ResponseWriter, r *http.Request) {
+	tag := normalizeHashtag(r.PathValue("tag"))
+	if tag == "" {
+		handleRequestErrors(w, "tag is invalid", http.StatusBadRequest)
+		return
+	}
+
+	page, err := parsePageParams(r, true)
+	if err != nil {
+		handleRequestErrors(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var chirps []database.Chirp
+	cursorCreatedAt, cursorId := page.cursorArgs()
+
+	if page.scanDesc() {
+		chirps, err = cfg.DbQueries.GetHashtagChirpsPageDesc(r.Context(), database.GetHashtagChirpsPageDescParams{
+			Tag:             tag,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			PageLimit:       page.fetchLimit(),
+		})
+	} else {
+		chirps, err = cfg.DbQueries.GetHashtagChirpsPageAsc(r.Context(), database.GetHashtagChirpsPageAscParams{
+			Tag:             tag,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			PageLimit:       page.fetchLimit(),
+		})
+	}
+
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting hashtag chirps: %s", err))
+		return
+	}
+
+	cfg.writeChirpsPage(w, r, chirps, page)
+}
+
+// GetTrending ranks tags by how often they were used within the window, which
+// defaults to the last 24 hours and is counted in whole hours.
+func (cfg *ApiConfig) GetTrending(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	window := defaultTrendingWindow
+	if wd := query.Get("window"); wd != "" {
+		d, err := time.ParseDuration(wd)
+		if err != nil || d < time.Hour || d > maxTrendingWindow {
+			handleRequestErrors(w, "window must be a duration between 1h and 168h", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+
+	limit := defaultTrendingLimit
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			handleRequestErrors(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxPageLimit)
+	}
+
+	since := cfg.Clock.Now().Add(-window).Truncate(time.Hour)
+	trending, err := cfg.DbQueries.GetTrendingHashtags(r.Context(), database.GetTrendingHashtagsParams{
+		Bucket: since,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting trending hashtags: %s", err))
+		return
+	}
+
+	resp := make([]trendingHashtagResponse, len(trending))
+	for i, t := range trending {
+		resp[i] = trendingHashtagResponse{
+			Tag:  t.Tag,
+			Uses: t.Uses,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	res, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
+
+func normalizeHashtag(tag string) string {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+	if tag == "" || len(tag) > maxHashtagLength {
+		return ""
+	}
+	for _, r := range tag {
+		if !isHashtagRune(r) {
+			return ""
+		}
+	}
+	return tag
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *ApiConfig) LikeChirp(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		handleRequestErrors(w, "chirp id is invalid", http.StatusBadRequest)
+		return
+	}
+
+	if !cfg.requireVerifiedEmail(w, r) {
+		return
+	}
+
+	jwtUserId := currentUserId(r)
+
+	_, err = cfg.DbQueries.GetChirp(r.Context(), chirpId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "chirp not found", http.StatusNotFound)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting chirp: %s", err))
+		return
+	}
+
+	// Liking twice is a no-op thanks to the (user_id, chirp_id) key.
+	err = cfg.DbQueries.CreateChirpLike(r.Context(), database.CreateChirpLikeParams{
+		UserID:  jwtUserId,
+		ChirpID: chirpId,
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error liking chirp: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *ApiConfig) UnlikeChirp(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		handleRequestErrors(w, "chirp id is invalid", http.StatusBadRequest)
+		return
+	}
+
+	jwtUserId := currentUserId(r)
+
+	err = cfg.DbQueries.DeleteChirpLike(r.Context(), database.DeleteChirpLikeParams{
+		UserID:  jwtUserId,
+		ChirpID: chirpId,
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error unliking chirp: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
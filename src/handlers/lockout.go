@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FerMusicComposer/chirpy/internal/auth"
+	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	loginThrottleAccount = "account"
+	loginThrottleIP      = "ip"
+
+	emailCooldownPasswordReset = "password_reset"
+	emailCooldownMagicLink     = "magic_link"
+)
+
+// An address gets more slack than an account since many users can share one.
+var (
+	accountLockout = auth.LockoutPolicy{Threshold: 5, Base: 30 * time.Second, Max: time.Hour}
+	ipLockout      = auth.LockoutPolicy{Threshold: 20, Base: time.Minute, Max: time.Hour}
+)
+
+func loginAccountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginRetryAfter is how long the account or the caller's address is still
+// locked out, or zero if neither is.
+func (cfg *ApiConfig) loginRetryAfter(ctx context.Context, accountKey, ip string) (time.Duration, error) {
+	seconds, err := cfg.DbQueries.GetLoginRetryAfter(ctx, database.GetLoginRetryAfterParams{
+		Now:        cfg.Clock.Now(),
+		AccountKey: accountKey,
+		IpKey:      ip,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// recordLoginFailure counts a failure against both the account and the
+// address, locking either one out once its policy says so. Failures to record
+// are logged rather than failing the login response.
+func (cfg *ApiConfig) recordLoginFailure(ctx context.Context, accountKey, ip string) {
+	cfg.recordThrottleFailure(ctx, loginThrottleAccount, accountKey, accountLockout)
+	cfg.recordThrottleFailure(ctx, loginThrottleIP, ip, ipLockout)
+}
+
+func (cfg *ApiConfig) recordThrottleFailure(ctx context.Context, scope, key string, policy auth.LockoutPolicy) {
+	now := cfg.Clock.Now()
+	failures, err := cfg.DbQueries.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Scope: scope,
+		Key:   key,
+		Now:   now,
+	})
+	if err != nil {
+		fmt.Println(fmt.Errorf("error recording login failure: %s", err))
+		return
+	}
+
+	lock := policy.Duration(int(failures))
+	if lock == 0 {
+		return
+	}
+
+	err = cfg.DbQueries.LockLogin(ctx, database.LockLoginParams{
+		LockedUntil: now.Add(lock),
+		Scope:       scope,
+		Key:         key,
+	})
+	if err != nil {
+		fmt.Println(fmt.Errorf("error locking login: %s", err))
+	}
+}
+
+// clearLoginFailures forgets an account's failures after a complete login.
+// Address counts are left alone so one valid account cannot be used to reset
+// an attacker's budget.
+func (cfg *ApiConfig) clearLoginFailures(ctx context.Context, accountKey string) {
+	err := cfg.DbQueries.ClearLoginThrottle(ctx, database.ClearLoginThrottleParams{
+		Scope: loginThrottleAccount,
+		Key:   accountKey,
+	})
+	if err != nil {
+		fmt.Println(fmt.Errorf("error clearing login failures: %s", err))
+	}
+}
+
+// startEmailCooldown records that an email of the given kind is about to be
+// sent to an address. If one was sent within cooldown it records nothing and
+// returns how long is left instead.
+func (cfg *ApiConfig) startEmailCooldown(ctx context.Context, kind, email string, cooldown time.Duration) (time.Duration, error) {
+	email = loginAccountKey(email)
+
+	now := cfg.Clock.Now()
+	started, err := cfg.DbQueries.StartEmailCooldown(ctx, database.StartEmailCooldownParams{
+		Kind:            kind,
+		Email:           email,
+		Now:             now,
+		CooldownSeconds: int32(cooldown / time.Second),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if started > 0 {
+		return 0, nil
+	}
+
+	seconds, err := cfg.DbQueries.GetEmailCooldownRetryAfter(ctx, database.GetEmailCooldownRetryAfterParams{
+		CooldownSeconds: int32(cooldown / time.Second),
+		Now:             now,
+		Kind:            kind,
+		Email:           email,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// The cooldown can run out between the two queries.
+	return time.Duration(max(seconds, 1)) * time.Second, nil
+}
+
+func writeTooManyLoginAttempts(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+	handleRequestErrors(w, "too many failed login attempts, try again later", http.StatusTooManyRequests)
+}
+
+// UnlockUser lets an admin lift a lockout on an account before it expires.
+func (cfg *ApiConfig) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		handleRequestErrors(w, "user id is invalid", http.StatusBadRequest)
+		return
+	}
+
+	user, err := cfg.DbQueries.GetUser(r.Context(), userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting user: %s", err))
+		return
+	}
+
+	err = cfg.DbQueries.ClearLoginThrottle(r.Context(), database.ClearLoginThrottleParams{
+		Scope: loginThrottleAccount,
+		Key:   loginAccountKey(user.Email),
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error unlocking user: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FerMusicComposer/chirpy/internal/auth"
+	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/FerMusicComposer/chirpy/internal/mailer"
+)
+
+const (
+	magicLinkTTL = 15 * time.Minute
+	// magicLinkCooldown is how long an address waits between sign-in links.
+	magicLinkCooldown = time.Minute
+)
+
+// RequestMagicLink mails a sign-in link and returns a nonce that must be sent
+// back with it. The response is the same whether or not the email has an
+// account, and so is the per-address throttle.
+func (cfg *ApiConfig) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	req := magicLinkRequest{}
+	err := decoder.Decode(&req)
+	if err != nil {
+		handleRequestErrors(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" {
+		handleRequestErrors(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	retryAfter, err := cfg.startEmailCooldown(r.Context(), emailCooldownMagicLink, req.Email, magicLinkCooldown)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error checking magic link cooldown: %s", err))
+		return
+	}
+
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+		handleRequestErrors(w, "a sign-in link was sent to this address recently, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	nonce, err := auth.MakeRefreshToken()
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error generating magic link nonce: %s", err))
+		return
+	}
+
+	// As with password resets, the account lookup and the mail happen after
+	// the response so its timing doesn't give registered addresses away.
+	expiresAt := cfg.Clock.Now().Add(magicLinkTTL)
+	cfg.sendInBackground("magic link", func(ctx context.Context) error {
+		return cfg.sendMagicLink(ctx, req.Email, nonce, expiresAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusAccepted)
+	res, err := json.Marshal(magicLinkResponse{
+		Nonce:     nonce,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
+
+func (cfg *ApiConfig) sendMagicLink(ctx context.Context, email, nonce string, expiresAt time.Time) error {
+	user, err := cfg.DbQueries.GetUserByEmail(ctx, email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	err = cfg.DbQueries.CreateMagicLinkToken(ctx, database.CreateMagicLinkTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		NonceHash: auth.HashToken(nonce),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	link, err := emailLink(cfg.EmailLinks.MagicLogin, token)
+	if err != nil {
+		return err
+	}
+
+	return cfg.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy sign-in link",
+		Body: fmt.Sprintf("Use this link to sign in to Chirpy:\n%s\n\n"+
+			"It works once, for the next 15 minutes, and only in the browser that asked for it. "+
+			"If you didn't try to sign in, you can ignore this email.", link),
+	})
+}
+
+// RedeemMagicLink answers like Login, including asking for a TOTP code when
+// the user has one set up.
+func (cfg *ApiConfig) RedeemMagicLink(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	req := redeemMagicLinkRequest{}
+	err := decoder.Decode(&req)
+	if err != nil {
+		handleRequestErrors(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" || req.Nonce == "" {
+		handleRequestErrors(w, "token and nonce are required", http.StatusBadRequest)
+		return
+	}
+
+	// A wrong nonce leaves the token unused, so a stolen link cannot be
+	// burned by someone who does not hold the nonce.
+	userId, err := cfg.DbQueries.UseMagicLinkToken(r.Context(), database.UseMagicLinkTokenParams{
+		TokenHash: auth.HashToken(req.Token),
+		NonceHash: auth.HashToken(req.Nonce),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error using magic link token: %s", err))
+		return
+	}
+
+	user, err := cfg.DbQueries.GetUser(r.Context(), userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting user: %s", err))
+		return
+	}
+
+	cfg.continueLogin(w, r, user)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	notificationKindMention = "mention"
+	notificationsLimit      = 50
+)
+
+// storeMentions resolves the @handles in a chirp to users, replaces the
+// chirp's stored mentions and notifies everyone mentioned. Handles that don't
+// belong to anyone are left as plain text. Notifications are unique per chirp,
+// so editing a chirp only notifies people who weren't mentioned before.
+func (cfg *ApiConfig) storeMentions(ctx context.Context, chirp database.Chirp) error {
+	err := cfg.DbQueries.DeleteChirpMentions(ctx, chirp.ID)
+	if err != nil {
+		return err
+	}
+
+	spans := extractMentions(chirp.Body)
+	if len(spans) == 0 {
+		return nil
+	}
+
+	handles := make([]string, len(spans))
+	for i, span := range spans {
+		handles[i] = strings.ToLower(span.Text)
+	}
+
+	users, err := cfg.DbQueries.GetUsersByHandles(ctx, handles)
+	if err != nil {
+		return err
+	}
+
+	userIds := make(map[string]uuid.UUID, len(users))
+	for _, user := range users {
+		userIds[strings.ToLower(user.Handle)] = user.ID
+	}
+
+	for _, span := range spans {
+		userId, found := userIds[strings.ToLower(span.Text)]
+		if !found {
+			continue
+		}
+
+		err = cfg.DbQueries.CreateChirpMention(ctx, database.CreateChirpMentionParams{
+			ChirpID:     chirp.ID,
+			UserID:      userId,
+			Handle:      span.Text,
+			StartOffset: int32(span.Start),
+			EndOffset:   int32(span.End),
+		})
+		if err != nil {
+			return err
+		}
+
+		if userId == chirp.UserID {
+			continue
+		}
+
+		err = cfg.DbQueries.CreateNotification(ctx, database.CreateNotificationParams{
+			UserID:  userId,
+			ActorID: chirp.UserID,
+			Kind:    notificationKindMention,
+			ChirpID: uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cfg *ApiConfig) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	jwtUserId := currentUserId(r)
+
+	notifications, err := cfg.DbQueries.GetNotifications(r.Context(), database.GetNotificationsParams{
+		UserID: jwtUserId,
+		Limit:  notificationsLimit,
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting notifications: %s", err))
+		return
+	}
+
+	resp := make([]notificationResponse, len(notifications))
+	for i, notification := range notifications {
+		resp[i] = notificationResponse{
+			ID:        notification.ID.String(),
+			CreatedAt: notification.CreatedAt.Format(time.RFC3339),
+			Kind:      notification.Kind,
+			ActorID:   notification.ActorID.String(),
+			Read:      notification.ReadAt.Valid,
+		}
+		if notification.ChirpID.Valid {
+			resp[i].ChirpID = notification.ChirpID.UUID.String()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	res, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
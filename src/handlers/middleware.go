@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/FerMusicComposer/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+// RequireAuth rejects requests without a valid access token carrying every
+// scope listed. The caller is available to next through currentUserId.
+func (cfg *ApiConfig) RequireAuth(next http.Handler, scopes ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := cfg.authenticate(w, r, scopes)
+		if !ok {
+			return
+		}
+
+		if principal == nil {
+			writeUnauthorized(w, "")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.ContextWithPrincipal(r.Context(), principal)))
+	})
+}
+
+// OptionalAuth lets anonymous requests through, but a token that is present
+// and invalid is still rejected so clients notice it expired.
+func (cfg *ApiConfig) OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := cfg.authenticate(w, r, nil)
+		if !ok {
+			return
+		}
+
+		if principal != nil {
+			r = r.WithContext(auth.ContextWithPrincipal(r.Context(), principal))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole must sit inside RequireAuth; it only checks the role of the
+// principal RequireAuth already stored.
+func (cfg *ApiConfig) RequireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := auth.PrincipalFromContext(r.Context())
+		if !ok {
+			writeUnauthorized(w, "")
+			return
+		}
+
+		if principal.Role != role {
+			handleRequestErrors(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate returns a nil principal when no credentials were sent. It only
+// returns false after it has written the error response itself.
+func (cfg *ApiConfig) authenticate(w http.ResponseWriter, r *http.Request, scopes []string) (*auth.Principal, bool) {
+	if r.Header.Get("Authorization") == "" {
+		return nil, true
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		writeUnauthorized(w, "invalid_token")
+		fmt.Println(fmt.Errorf("error obtaining bearer: %s", err))
+		return nil, false
+	}
+
+	if auth.IsPersonalAccessToken(token) {
+		return cfg.authenticatePersonalAccessToken(w, r, token, scopes)
+	}
+
+	claims, err := cfg.JWTKeys.ParseJWT(token, auth.WithScopes(scopes...))
+	if err != nil {
+		if errors.Is(err, auth.ErrInsufficientScope) {
+			writeInsufficientScope(w, scopes)
+			return nil, false
+		}
+
+		writeUnauthorized(w, "invalid_token")
+		fmt.Println(fmt.Errorf("error validating jwt: %s", err))
+		return nil, false
+	}
+
+	principal, err := auth.PrincipalFromClaims(claims)
+	if err != nil {
+		writeUnauthorized(w, "invalid_token")
+		fmt.Println(fmt.Errorf("error reading jwt subject: %s", err))
+		return nil, false
+	}
+
+	// Access tokens outlive a deletion request, so the account is checked
+	// on every request rather than trusting the token until it expires.
+	active, err := cfg.DbQueries.IsActiveUser(r.Context(), principal.UserID)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error checking user: %s", err))
+		return nil, false
+	}
+	if !active {
+		writeUnauthorized(w, "invalid_token")
+		return nil, false
+	}
+
+	return principal, true
+}
+
+func (cfg *ApiConfig) authenticatePersonalAccessToken(w http.ResponseWriter, r *http.Request, token string, scopes []string) (*auth.Principal, bool) {
+	pat, err := cfg.DbQueries.GetPersonalAccessTokenByHash(r.Context(), auth.HashToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeUnauthorized(w, "invalid_token")
+			return nil, false
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting personal access token: %s", err))
+		return nil, false
+	}
+
+	if pat.RevokedAt.Valid || pat.ExpiresAt.Before(cfg.Clock.Now()) {
+		writeUnauthorized(w, "invalid_token")
+		return nil, false
+	}
+
+	principal := &auth.Principal{
+		UserID: pat.UserID,
+		Role:   pat.Role,
+		Scopes: pat.Scopes,
+	}
+	if !principal.HasScopes(scopes...) {
+		writeInsufficientScope(w, scopes)
+		return nil, false
+	}
+
+	// Throttled in the query, so busy bots do not write on every request.
+	err = cfg.DbQueries.TouchPersonalAccessToken(r.Context(), pat.ID)
+	if err != nil {
+		fmt.Println(fmt.Errorf("error updating personal access token: %s", err))
+	}
+
+	return principal, true
+}
+
+// writeUnauthorized is the single 401 response for missing or bad credentials,
+// with the RFC 6750 challenge. authErr is empty when nothing was presented.
+func writeUnauthorized(w http.ResponseWriter, authErr string) {
+	challenge := `Bearer realm="chirpy"`
+	if authErr != "" {
+		challenge += fmt.Sprintf(`, error="%s"`, authErr)
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
+}
+
+func writeInsufficientScope(w http.ResponseWriter, scopes []string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="chirpy", error="insufficient_scope", scope="%s"`, strings.Join(scopes, " ")))
+	handleRequestErrors(w, "insufficient scope", http.StatusForbidden)
+}
+
+// currentUserId is the caller of a handler wrapped in RequireAuth.
+func currentUserId(r *http.Request) uuid.UUID {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	return principal.UserID
+}
+
+// currentSessionId is the login session of the caller of a handler wrapped in
+// RequireAuth. It is unset for personal access tokens.
+func currentSessionId(r *http.Request) uuid.NullUUID {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	return principal.SessionID
+}
+
+// optionalUserId is the caller of a handler wrapped in OptionalAuth, if any.
+func optionalUserId(r *http.Request) uuid.NullUUID {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		return uuid.NullUUID{}
+	}
+
+	return uuid.NullUUID{UUID: principal.UserID, Valid: true}
+}
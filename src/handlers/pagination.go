@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// pageCursor is a keyset position on (created_at, id). Clients only ever see
+// it as an opaque string.
+type pageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+type pageParams struct {
+	limit  int32
+	desc   bool
+	cursor *pageCursor
+	// before is true when the cursor points at the page after the one
+	// requested, i.e. the client is paging backwards.
+	before bool
+}
+
+func encodeCursor(c pageCursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, errors.New("invalid cursor")
+	}
+
+	createdAt, id, found := strings.Cut(string(raw), "|")
+	if !found {
+		return pageCursor{}, errors.New("invalid cursor")
+	}
+
+	c := pageCursor{}
+	c.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return pageCursor{}, errors.New("invalid cursor")
+	}
+	c.ID, err = uuid.Parse(id)
+	if err != nil {
+		return pageCursor{}, errors.New("invalid cursor")
+	}
+
+	return c, nil
+}
+
+func parsePageParams(r *http.Request, defaultDesc bool) (pageParams, error) {
+	query := r.URL.Query()
+	p := pageParams{
+		limit: defaultPageLimit,
+		desc:  defaultDesc,
+	}
+
+	switch query.Get("sort") {
+	case "asc":
+		p.desc = false
+	case "desc":
+		p.desc = true
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return pageParams{}, errors.New("limit must be a positive integer")
+		}
+		p.limit = int32(min(n, maxPageLimit))
+	}
+
+	after, before := query.Get("after"), query.Get("before")
+	if after != "" && before != "" {
+		return pageParams{}, errors.New("after and before cannot be combined")
+	}
+
+	if after != "" || before != "" {
+		c, err := decodeCursor(after + before)
+		if err != nil {
+			return pageParams{}, err
+		}
+		p.cursor = &c
+		p.before = before != ""
+	}
+
+	return p, nil
+}
+
+// scanDesc reports whether the database has to be scanned newest first. A
+// backwards page is read in the opposite direction and flipped afterwards.
+func (p pageParams) scanDesc() bool {
+	return p.desc != p.before
+}
+
+// fetchLimit asks for one extra row so we know whether there is another page.
+func (p pageParams) fetchLimit() int32 {
+	return p.limit + 1
+}
+
+func (p pageParams) cursorArgs() (sql.NullTime, uuid.NullUUID) {
+	if p.cursor == nil {
+		return sql.NullTime{}, uuid.NullUUID{}
+	}
+	return sql.NullTime{Time: p.cursor.CreatedAt, Valid: true}, uuid.NullUUID{UUID: p.cursor.ID, Valid: true}
+}
+
+// paginate trims the extra row fetched by fetchLimit, restores the requested
+// order and works out the cursors for the neighbouring pages.
+func paginate[T any](items []T, p pageParams, key func(T) pageCursor) (page []T, next, prev *pageCursor) {
+	hasMore := len(items) > int(p.limit)
+	if hasMore {
+		items = items[:p.limit]
+	}
+
+	if p.before {
+		slices.Reverse(items)
+	}
+
+	if len(items) == 0 {
+		return items, nil, nil
+	}
+
+	first := key(items[0])
+	last := key(items[len(items)-1])
+
+	if p.before {
+		next = &last
+		if hasMore {
+			prev = &first
+		}
+	} else {
+		if hasMore {
+			next = &last
+		}
+		if p.cursor != nil {
+			prev = &first
+		}
+	}
+
+	return items, next, prev
+}
+
+func chirpCursor(chirp database.Chirp) pageCursor {
+	return pageCursor{CreatedAt: chirp.CreatedAt, ID: chirp.ID}
+}
+
+// setPaginationHeaders exposes the neighbouring pages both as an RFC 8288 Link
+// header and as plain cursor headers for clients that build their own URLs.
+// The cursors stay out of the body on purpose: list endpoints have always
+// answered with a bare JSON array, and wrapping it in an object to carry
+// next_cursor would break every existing client.
+func setPaginationHeaders(w http.ResponseWriter, r *http.Request, next, prev *pageCursor) {
+	links := []string{}
+
+	if next != nil {
+		cursor := encodeCursor(*next)
+		w.Header().Set("X-Next-Cursor", cursor)
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(r, "after", cursor)))
+	}
+
+	if prev != nil {
+		cursor := encodeCursor(*prev)
+		w.Header().Set("X-Prev-Cursor", cursor)
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(r, "before", cursor)))
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+func pageURL(r *http.Request, key, cursor string) string {
+	query := r.URL.Query()
+	query.Del("after")
+	query.Del("before")
+	query.Set(key, cursor)
+
+	u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return u.String()
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var testPageEpoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testCursor gives every int item its own position, ordered like the int.
+func testCursor(i int) pageCursor {
+	return pageCursor{
+		CreatedAt: testPageEpoch.Add(time.Duration(i) * time.Minute),
+		ID:        uuid.NewSHA1(uuid.Nil, []byte{byte(i)}),
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	someCursor := testCursor(100)
+
+	testCases := []struct {
+		name     string
+		items    []int
+		params   pageParams
+		expected []int
+		next     *int
+		prev     *int
+	}{
+		{
+			name:     "first page with more",
+			items:    []int{1, 2, 3, 4},
+			params:   pageParams{limit: 3},
+			expected: []int{1, 2, 3},
+			next:     ptr(3),
+		},
+		{
+			name:     "exactly limit rows is the last page",
+			items:    []int{1, 2, 3},
+			params:   pageParams{limit: 3},
+			expected: []int{1, 2, 3},
+		},
+		{
+			name:     "after a cursor has a previous page",
+			items:    []int{4, 5},
+			params:   pageParams{limit: 3, cursor: &someCursor},
+			expected: []int{4, 5},
+			prev:     ptr(4),
+		},
+		{
+			name:     "before a cursor is reversed back into order",
+			items:    []int{6, 5, 4, 3},
+			params:   pageParams{limit: 3, cursor: &someCursor, before: true},
+			expected: []int{4, 5, 6},
+			next:     ptr(6),
+			prev:     ptr(4),
+		},
+		{
+			name:     "before a cursor reaching the start",
+			items:    []int{2, 1},
+			params:   pageParams{limit: 3, cursor: &someCursor, before: true},
+			expected: []int{1, 2},
+			next:     ptr(2),
+		},
+		{
+			name:     "empty page",
+			items:    []int{},
+			params:   pageParams{limit: 3, cursor: &someCursor},
+			expected: []int{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			page, next, prev := paginate(tc.items, tc.params, testCursor)
+
+			if !slices.Equal(page, tc.expected) {
+				t.Errorf("expected page %v, but got %v", tc.expected, page)
+			}
+			checkCursor(t, "next", next, tc.next)
+			checkCursor(t, "prev", prev, tc.prev)
+		})
+	}
+}
+
+func checkCursor(t *testing.T, name string, got *pageCursor, expected *int) {
+	t.Helper()
+
+	switch {
+	case expected == nil && got != nil:
+		t.Errorf("expected no %s cursor, but got %v", name, *got)
+	case expected != nil && got == nil:
+		t.Errorf("expected a %s cursor at %d, but got none", name, *expected)
+	case expected != nil && *got != testCursor(*expected):
+		t.Errorf("expected the %s cursor at %d, but got %v", name, *expected, *got)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := pageCursor{
+		CreatedAt: time.Date(2025, 3, 4, 5, 6, 7, 123456789, time.UTC),
+		ID:        uuid.New(),
+	}
+
+	got, err := decodeCursor(encodeCursor(c))
+	if err != nil {
+		t.Fatalf("decodeCursor() returned an unexpected error: %v", err)
+	}
+	if !got.CreatedAt.Equal(c.CreatedAt) || got.ID != c.ID {
+		t.Errorf("expected %v, but got %v", c, got)
+	}
+}
+
+func TestDecodeCursorRejectsMalformed(t *testing.T) {
+	valid := encodeCursor(testCursor(1))
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	testCases := []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"not base64", "!!!"},
+		{"truncated", valid[:len(valid)-4]},
+		{"tampered", valid[:10] + "A" + valid[11:]},
+		{"no separator", encode("2025-01-01T00:00:00Z")},
+		{"bad time", encode("yesterday|" + uuid.NewString())},
+		{"bad id", encode("2025-01-01T00:00:00Z|not-a-uuid")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := decodeCursor(tc.cursor); err == nil {
+				t.Errorf("expected %q to be rejected", tc.cursor)
+			}
+		})
+	}
+}
+
+func TestParsePageParams(t *testing.T) {
+	cursor := encodeCursor(testCursor(1))
+
+	testCases := []struct {
+		query   string
+		wantErr bool
+		limit   int32
+		desc    bool
+		before  bool
+	}{
+		{query: "", limit: defaultPageLimit},
+		{query: "limit=500", limit: maxPageLimit},
+		{query: "limit=0", wantErr: true},
+		{query: "limit=abc", wantErr: true},
+		{query: "sort=desc", limit: defaultPageLimit, desc: true},
+		{query: "before=" + cursor, limit: defaultPageLimit, before: true},
+		{query: "after=" + cursor + "&before=" + cursor, wantErr: true},
+		{query: "after=garbage", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		r := httptest.NewRequest("GET", "/api/chirps?"+tc.query, nil)
+		p, err := parsePageParams(r, false)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error", tc.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.query, err)
+			continue
+		}
+		if p.limit != tc.limit || p.desc != tc.desc || p.before != tc.before {
+			t.Errorf("%q: expected limit=%d desc=%v before=%v, but got %+v", tc.query, tc.limit, tc.desc, tc.before, p)
+		}
+	}
+}
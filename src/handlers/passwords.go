@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FerMusicComposer/chirpy/internal/auth"
+	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/FerMusicComposer/chirpy/internal/mailer"
+)
+
+const (
+	passwordResetTTL = time.Hour
+	// passwordResetCooldown is how long an address waits between reset emails.
+	passwordResetCooldown = time.Minute
+)
+
+// ForgotPassword always answers 202 so it cannot be used to find out which
+// emails have accounts. It is throttled per address, whether or not the
+// address has an account, for the same reason.
+func (cfg *ApiConfig) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	req := forgotPasswordRequest{}
+	err := decoder.Decode(&req)
+	if err != nil {
+		handleRequestErrors(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" {
+		handleRequestErrors(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	retryAfter, err := cfg.startEmailCooldown(r.Context(), emailCooldownPasswordReset, req.Email, passwordResetCooldown)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error checking password reset cooldown: %s", err))
+		return
+	}
+
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+		handleRequestErrors(w, "a reset email was sent to this address recently, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	// Looking the account up and mailing it happen after the response, so
+	// its timing is the same whether or not the address is registered.
+	cfg.sendInBackground("password reset", func(ctx context.Context) error {
+		return cfg.sendPasswordReset(ctx, req.Email)
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *ApiConfig) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := cfg.DbQueries.GetUserByEmail(ctx, email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	// Only the newest link works.
+	err = cfg.DbQueries.DeleteUserPasswordResetTokens(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	err = cfg.DbQueries.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: cfg.Clock.Now().Add(passwordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link, err := emailLink(cfg.EmailLinks.ResetPassword, token)
+	if err != nil {
+		return err
+	}
+
+	return cfg.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+			"Use this link within the next hour to choose a new one:\n%s\n\n"+
+			"If it wasn't you, you can ignore this email.", link),
+	})
+}
+
+// ResetPassword signs the user out everywhere, since whoever knew the old
+// password may still hold a session.
+func (cfg *ApiConfig) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	req := resetPasswordRequest{}
+	err := decoder.Decode(&req)
+	if err != nil {
+		handleRequestErrors(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" {
+		handleRequestErrors(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	tokenHash := auth.HashToken(req.Token)
+	resetToken, err := cfg.DbQueries.GetPasswordResetToken(r.Context(), tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "reset token is invalid or expired", http.StatusBadRequest)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting password reset token: %s", err))
+		return
+	}
+
+	user, err := cfg.DbQueries.GetUser(r.Context(), resetToken.UserID)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting user: %s", err))
+		return
+	}
+
+	// The password is checked before the token is used, so a rejected one
+	// can be retried with the same link.
+	fields, err := cfg.checkPassword(req.Password, user.Email, user.Handle, user.DisplayName)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error checking password policy: %s", err))
+		return
+	}
+
+	if len(fields) > 0 {
+		handleValidationErrors(w, fields)
+		return
+	}
+
+	hashedPwd, err := cfg.Passwords.Hash(req.Password)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error hashing password: %s", err))
+		return
+	}
+
+	// Marking the token used is what redeems it, so two requests racing with
+	// the same token cannot both succeed.
+	userId, err := cfg.DbQueries.UsePasswordResetToken(r.Context(), tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "reset token is invalid or expired", http.StatusBadRequest)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error using password reset token: %s", err))
+		return
+	}
+
+	user, err = cfg.DbQueries.UpdateUser(r.Context(), database.UpdateUserParams{
+		ID:             userId,
+		HashedPassword: sql.NullString{String: hashedPwd, Valid: true},
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error updating password: %s", err))
+		return
+	}
+
+	err = cfg.DbQueries.RevokeUserRefreshTokens(r.Context(), userId)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error revoking refresh tokens: %s", err))
+		return
+	}
+
+	// A lockout from someone guessing the old password should not keep the
+	// owner out once they have proven control of the email.
+	cfg.clearLoginFailures(r.Context(), loginAccountKey(user.Email))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// upgradePasswordHash rehashes a password that was just checked if its hash
+// uses outdated parameters. It only replaces the hash it checked, so a
+// password changed in the meantime is left alone. Failures are logged since
+// the old hash still works.
+func (cfg *ApiConfig) upgradePasswordHash(ctx context.Context, user database.User, password string) {
+	if !cfg.Passwords.NeedsRehash(user.HashedPassword) {
+		return
+	}
+
+	hashedPwd, err := cfg.Passwords.Hash(password)
+	if err != nil {
+		fmt.Println(fmt.Errorf("error rehashing password: %s", err))
+		return
+	}
+
+	updated, err := cfg.DbQueries.RehashUserPassword(ctx, database.RehashUserPasswordParams{
+		NewHash: hashedPwd,
+		ID:      user.ID,
+		OldHash: user.HashedPassword,
+	})
+	if err != nil {
+		fmt.Println(fmt.Errorf("error storing rehashed password: %s", err))
+		return
+	}
+
+	if updated > 0 {
+		cfg.PwdRehashes.Add(1)
+	}
+}
+
+// checkPassword turns policy violations into field errors for "password".
+// context is what is known about the user, see auth.PasswordPolicy.Check.
+func (cfg *ApiConfig) checkPassword(password string, context ...string) ([]fieldError, error) {
+	violations, err := cfg.PasswordPolicy.Check(password, context...)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []fieldError{}
+	for _, v := range violations {
+		fields = append(fields, fieldError{Field: "password", Code: v.Code, Message: v.Message})
+	}
+	return fields, nil
+}
+
+// passwordContext lists the user's details, and any the request is about to
+// change, for checkPassword.
+func passwordContext(user database.User, req updateUserRequest) []string {
+	context := []string{user.Email, user.Handle, user.DisplayName}
+	for _, s := range []*string{req.Email, req.Handle, req.DisplayName} {
+		if s != nil {
+			context = append(context, *s)
+		}
+	}
+	return context
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	chirpKindChirp   = "chirp"
+	chirpKindRechirp = "rechirp"
+	chirpKindQuote   = "quote"
+)
+
+func (cfg *ApiConfig) Rechirp(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		handleRequestErrors(w, "chirp id is invalid", http.StatusBadRequest)
+		return
+	}
+
+	if !cfg.requireVerifiedEmail(w, r) {
+		return
+	}
+
+	jwtUserId := currentUserId(r)
+
+	original, err := cfg.DbQueries.GetChirp(r.Context(), chirpId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "chirp not found", http.StatusNotFound)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting chirp: %s", err))
+		return
+	}
+
+	rechirp, err := cfg.DbQueries.CreateRechirp(r.Context(), database.CreateRechirpParams{
+		UserID:     jwtUserId,
+		OriginalID: rootChirpId(original),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "chirp already rechirped", http.StatusConflict)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error creating rechirp: %s", err))
+		return
+	}
+
+	resp, err := cfg.chirpResponses(r.Context(), uuid.NullUUID{UUID: jwtUserId, Valid: true}, []database.Chirp{rechirp})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error building chirp response: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusCreated)
+	res, err := json.Marshal(resp[0])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
+
+func (cfg *ApiConfig) Unrechirp(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		handleRequestErrors(w, "chirp id is invalid", http.StatusBadRequest)
+		return
+	}
+
+	jwtUserId := currentUserId(r)
+
+	// The path may name a rechirp rather than the original, just as it may
+	// when rechirping, so it is resolved the same way.
+	chirp, err := cfg.DbQueries.GetChirp(r.Context(), chirpId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "chirp not found", http.StatusNotFound)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting chirp: %s", err))
+		return
+	}
+
+	deleted, err := cfg.DbQueries.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+		UserID:     jwtUserId,
+		OriginalID: rootChirpId(chirp),
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error deleting rechirp: %s", err))
+		return
+	}
+
+	if deleted == 0 {
+		handleRequestErrors(w, "rechirp not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rootChirpId is the chirp a rechirp or quote of the given chirp should point
+// at. Rechirping a rechirp references the original, so nothing nests.
+func rootChirpId(chirp database.Chirp) uuid.NullUUID {
+	if chirp.Kind == chirpKindRechirp && chirp.OriginalID.Valid {
+		return chirp.OriginalID
+	}
+	return uuid.NullUUID{UUID: chirp.ID, Valid: true}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// SearchChirps runs a web-style full-text query ("quoted phrases", or, -word)
+// over chirp bodies. Results are ranked, so they are paged with an offset
+// rather than a keyset cursor.
+func (cfg *ApiConfig) SearchChirps(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	q := query.Get("q")
+	if q == "" {
+		handleRequestErrors(w, "q is required", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	authorId := uuid.NullUUID{}
+	if userId := query.Get("author_id"); userId != "" {
+		authorId.UUID, err = uuid.Parse(userId)
+		if err != nil {
+			handleRequestErrors(w, "author_id is invalid", http.StatusBadRequest)
+			return
+		}
+		authorId.Valid = true
+	}
+
+	limit := defaultPageLimit
+	if l := query.Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 {
+			handleRequestErrors(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(limit, maxPageLimit)
+	}
+
+	offset := 0
+	if o := query.Get("offset"); o != "" {
+		offset, err = strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			handleRequestErrors(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		// Leaves room for the next page's offset to fit the query's int32.
+		if offset > math.MaxInt32-maxPageLimit {
+			handleRequestErrors(w, "offset is too large", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rows, err := cfg.DbQueries.SearchChirps(r.Context(), database.SearchChirpsParams{
+		Query:      q,
+		AuthorID:   authorId,
+		PageLimit:  int32(limit),
+		PageOffset: int32(offset),
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error searching chirps: %s", err))
+		return
+	}
+
+	chirps := make([]database.Chirp, len(rows))
+	for i, row := range rows {
+		chirps[i] = database.Chirp{
+			ID:         row.ID,
+			CreatedAt:  row.CreatedAt,
+			UpdatedAt:  row.UpdatedAt,
+			Body:       row.Body,
+			UserID:     row.UserID,
+			ParentID:   row.ParentID,
+			LikeCount:  row.LikeCount,
+			Kind:       row.Kind,
+			OriginalID: row.OriginalID,
+			EditedAt:   row.EditedAt,
+		}
+	}
+
+	chirpsResp, err := cfg.chirpResponses(r.Context(), optionalUserId(r), chirps)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error building chirps response: %s", err))
+		return
+	}
+
+	resp := make([]searchChirpResponse, len(rows))
+	for i, row := range rows {
+		resp[i] = searchChirpResponse{
+			createChirpResponse: chirpsResp[i],
+			Rank:                row.Rank,
+			Snippet:             highlightSnippet(row.Snippet),
+		}
+	}
+
+	if len(rows) == limit {
+		next := query
+		next.Set("offset", strconv.Itoa(offset+limit))
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, next.Encode()))
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	res, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
+
+// The search query has ts_headline mark matches with these control characters,
+// which it first strips from the body, instead of with HTML tags.
+const (
+	snippetStartSel = "\x02"
+	snippetStopSel  = "\x03"
+)
+
+var snippetMarks = strings.NewReplacer(snippetStartSel, "<mark>", snippetStopSel, "</mark>")
+
+// highlightSnippet returns a ts_headline snippet as HTML. The chirp text is
+// escaped, so the <mark> tags around the matches are the only markup in it.
+func highlightSnippet(snippet string) string {
+	return snippetMarks.Replace(html.EscapeString(snippet))
+}
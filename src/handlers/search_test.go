@@ -0,0 +1,41 @@
+package handlers
+
+import "testing"
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet string
+		want    string
+	}{
+		{
+			name:    "marks matches",
+			snippet: "learning \x02go\x03 today",
+			want:    "learning <mark>go</mark> today",
+		},
+		{
+			name:    "escapes markup in the chirp",
+			snippet: "<script>alert(1)</script> \x02go\x03",
+			want:    "&lt;script&gt;alert(1)&lt;/script&gt; <mark>go</mark>",
+		},
+		{
+			name:    "escapes a literal mark tag",
+			snippet: "<mark>not a match</mark> & \"quotes\"",
+			want:    "&lt;mark&gt;not a match&lt;/mark&gt; &amp; &#34;quotes&#34;",
+		},
+		{
+			name:    "no matches",
+			snippet: "plain text",
+			want:    "plain text",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := highlightSnippet(tt.snippet)
+			if got != tt.want {
+				t.Errorf("highlightSnippet(%q) = %q, want %q", tt.snippet, got, tt.want)
+			}
+		})
+	}
+}
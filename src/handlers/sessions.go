@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// A session is a refresh token family: it starts at login and survives every
+// rotation, so its id is the family id rather than any single token.
+
+func (cfg *ApiConfig) GetSessions(w http.ResponseWriter, r *http.Request) {
+	jwtUserId := currentUserId(r)
+
+	sessions, err := cfg.DbQueries.GetUserSessions(r.Context(), jwtUserId)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting sessions: %s", err))
+		return
+	}
+
+	resp := make([]sessionResponse, len(sessions))
+	for i, session := range sessions {
+		resp[i] = sessionResponse{
+			ID:         session.FamilyID.String(),
+			SignedInAt: session.SignedInAt.Format(time.RFC3339),
+			LastUsedAt: session.LastUsedAt.Format(time.RFC3339),
+			ExpiresAt:  session.ExpiresAt.Format(time.RFC3339),
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IpAddress,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	res, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
+
+func (cfg *ApiConfig) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		handleRequestErrors(w, "session id is invalid", http.StatusBadRequest)
+		return
+	}
+
+	jwtUserId := currentUserId(r)
+
+	revoked, err := cfg.DbQueries.RevokeUserSession(r.Context(), database.RevokeUserSessionParams{
+		FamilyID: sessionId,
+		UserID:   jwtUserId,
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error revoking session: %s", err))
+		return
+	}
+
+	// Someone else's session looks exactly like one that does not exist.
+	if revoked == 0 {
+		handleRequestErrors(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeAllSessions logs the caller out everywhere. Access tokens already
+// handed out stay valid until they expire.
+func (cfg *ApiConfig) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	jwtUserId := currentUserId(r)
+
+	err := cfg.DbQueries.RevokeUserRefreshTokens(r.Context(), jwtUserId)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error revoking sessions: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
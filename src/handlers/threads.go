@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxThreadDescendants and maxThreadDepth cap how much of a conversation a
+// single thread request walks; clients can page deeper branches through
+// /replies.
+const (
+	maxThreadDescendants = 500
+	maxThreadDepth       = 50
+)
+
+func (cfg *ApiConfig) GetChirpReplies(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		handleRequestErrors(w, "chirp id is invalid", http.StatusBadRequest)
+		return
+	}
+
+	page, err := parsePageParams(r, false)
+	if err != nil {
+		handleRequestErrors(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = cfg.DbQueries.GetChirp(r.Context(), chirpId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "chirp not found", http.StatusNotFound)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting chirp: %s", err))
+		return
+	}
+
+	var chirps []database.Chirp
+	parentId := uuid.NullUUID{UUID: chirpId, Valid: true}
+	cursorCreatedAt, cursorId := page.cursorArgs()
+
+	if page.scanDesc() {
+		chirps, err = cfg.DbQueries.GetChirpsPageDesc(r.Context(), database.GetChirpsPageDescParams{
+			ParentID:        parentId,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			PageLimit:       page.fetchLimit(),
+		})
+	} else {
+		chirps, err = cfg.DbQueries.GetChirpsPageAsc(r.Context(), database.GetChirpsPageAscParams{
+			ParentID:        parentId,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorId,
+			PageLimit:       page.fetchLimit(),
+		})
+	}
+
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting replies: %s", err))
+		return
+	}
+
+	cfg.writeChirpsPage(w, r, chirps, page)
+}
+
+// GetChirpThread returns the chain of chirps the given chirp replies to (root
+// first) and every reply below it, oldest first. Each entry carries its
+// in_reply_to so clients can rebuild the tree.
+func (cfg *ApiConfig) GetChirpThread(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		handleRequestErrors(w, "chirp id is invalid", http.StatusBadRequest)
+		return
+	}
+
+	chirp, err := cfg.DbQueries.GetChirp(r.Context(), chirpId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "chirp not found", http.StatusNotFound)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting chirp: %s", err))
+		return
+	}
+
+	ancestors, err := cfg.DbQueries.GetChirpAncestors(r.Context(), chirpId)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting chirp ancestors: %s", err))
+		return
+	}
+
+	descendants, err := cfg.DbQueries.GetChirpDescendants(r.Context(), database.GetChirpDescendantsParams{
+		ParentID: uuid.NullUUID{UUID: chirpId, Valid: true},
+		MaxDepth: maxThreadDepth,
+		Limit:    maxThreadDescendants,
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting chirp descendants: %s", err))
+		return
+	}
+
+	// One batch for the whole thread keeps liked_by_me to a single query.
+	thread := make([]database.Chirp, 0, len(ancestors)+1+len(descendants))
+	thread = append(thread, ancestors...)
+	thread = append(thread, chirp)
+	thread = append(thread, descendants...)
+
+	chirps, err := cfg.chirpResponses(r.Context(), optionalUserId(r), thread)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error building thread response: %s", err))
+		return
+	}
+
+	resp := chirpThreadResponse{
+		Ancestors:   chirps[:len(ancestors)],
+		Chirp:       chirps[len(ancestors)],
+		Descendants: chirps[len(ancestors)+1:],
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	res, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
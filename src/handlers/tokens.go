@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/FerMusicComposer/chirpy/internal/auth"
+	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxTokenNameLength       = 100
+	defaultTokenLifetimeDays = 30
+	maxTokenLifetimeDays     = 365
+)
+
+// personalAccessTokenScopes leaves out auth.ScopeAccount, so a leaked API
+// token can post as the user but cannot change their password, mint more
+// tokens or end their sessions.
+var personalAccessTokenScopes = []string{auth.ScopeChirpsRead, auth.ScopeChirpsWrite}
+
+func (cfg *ApiConfig) CreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	req := createTokenRequest{}
+	err := decoder.Decode(&req)
+	if err != nil {
+		handleRequestErrors(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || utf8.RuneCountInString(req.Name) > maxTokenNameLength {
+		handleRequestErrors(w, fmt.Sprintf("name must be between 1 and %d characters", maxTokenNameLength), http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Scopes) == 0 {
+		handleRequestErrors(w, "at least one scope is required", http.StatusBadRequest)
+		return
+	}
+
+	for _, scope := range req.Scopes {
+		if !slices.Contains(personalAccessTokenScopes, scope) {
+			handleRequestErrors(w, fmt.Sprintf("scope must be one of: %s", strings.Join(personalAccessTokenScopes, ", ")), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultTokenLifetimeDays
+	}
+
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > maxTokenLifetimeDays {
+		handleRequestErrors(w, fmt.Sprintf("expires_in_days must be between 1 and %d", maxTokenLifetimeDays), http.StatusBadRequest)
+		return
+	}
+
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error generating personal access token: %s", err))
+		return
+	}
+
+	slices.Sort(req.Scopes)
+	pat, err := cfg.DbQueries.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    currentUserId(r),
+		Name:      req.Name,
+		TokenHash: auth.HashToken(token),
+		Scopes:    slices.Compact(req.Scopes),
+		ExpiresAt: cfg.Clock.Now().AddDate(0, 0, req.ExpiresInDays),
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error creating personal access token: %s", err))
+		return
+	}
+
+	resp := newPersonalAccessTokenResponse(pat)
+	resp.Token = token
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusCreated)
+	res, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
+
+func (cfg *ApiConfig) GetPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	pats, err := cfg.DbQueries.GetPersonalAccessTokens(r.Context(), currentUserId(r))
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting personal access tokens: %s", err))
+		return
+	}
+
+	resp := make([]personalAccessTokenResponse, len(pats))
+	for i, pat := range pats {
+		resp[i] = newPersonalAccessTokenResponse(pat)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	res, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
+
+func (cfg *ApiConfig) RevokePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	tokenId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		handleRequestErrors(w, "token id is invalid", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := cfg.DbQueries.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenId,
+		UserID: currentUserId(r),
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error revoking personal access token: %s", err))
+		return
+	}
+
+	if revoked == 0 {
+		handleRequestErrors(w, "token not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newPersonalAccessTokenResponse(pat database.PersonalAccessToken) personalAccessTokenResponse {
+	resp := personalAccessTokenResponse{
+		ID:        pat.ID.String(),
+		Name:      pat.Name,
+		Scopes:    pat.Scopes,
+		CreatedAt: pat.CreatedAt.Format(time.RFC3339),
+		ExpiresAt: pat.ExpiresAt.Format(time.RFC3339),
+	}
+	if pat.LastUsedAt.Valid {
+		lastUsedAt := pat.LastUsedAt.Time.Format(time.RFC3339)
+		resp.LastUsedAt = &lastUsedAt
+	}
+
+	return resp
+}
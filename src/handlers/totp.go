@@ -0,0 +1,455 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/FerMusicComposer/chirpy/internal/auth"
+	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer        = "Chirpy"
+	recoveryCodeCount = 10
+	mfaChallengeTTL   = 5 * time.Minute
+	// maxMFAAttempts caps guesses per challenge so a 6 digit code cannot be
+	// brute forced; the user has to log in with their password again.
+	maxMFAAttempts = 5
+)
+
+// EnrollTOTP creates a pending secret. It only takes effect once VerifyTOTP
+// sees a code generated from it.
+func (cfg *ApiConfig) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	jwtUserId := currentUserId(r)
+
+	user, err := cfg.DbQueries.GetUser(r.Context(), jwtUserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting user: %s", err))
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error generating totp secret: %s", err))
+		return
+	}
+
+	_, err = cfg.DbQueries.UpsertUserTOTP(r.Context(), database.UpsertUserTOTPParams{
+		UserID: user.ID,
+		Secret: secret,
+	})
+	if err != nil {
+		// The upsert skips users who already finished enrollment.
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error storing totp secret: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusCreated)
+	res, err := json.Marshal(totpEnrollmentResponse{
+		Secret:     secret,
+		OtpauthURI: auth.TOTPURI(secret, totpIssuer, user.Email),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
+
+// VerifyTOTP turns 2FA on and returns the recovery codes, which are never
+// shown again.
+func (cfg *ApiConfig) VerifyTOTP(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	req := totpCodeRequest{}
+	err := decoder.Decode(&req)
+	if err != nil {
+		handleRequestErrors(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	jwtUserId := currentUserId(r)
+
+	totp, err := cfg.DbQueries.GetUserTOTP(r.Context(), jwtUserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "two-factor authentication is not set up", http.StatusNotFound)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting totp: %s", err))
+		return
+	}
+
+	if totp.EnabledAt.Valid {
+		handleRequestErrors(w, "two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	// Recovery codes do not exist yet, so only an authenticator code will do.
+	ok, err := cfg.useTOTPCode(r.Context(), totp, req.Code)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error checking totp code: %s", err))
+		return
+	}
+
+	if !ok {
+		handleRequestErrors(w, "invalid code", http.StatusForbidden)
+		return
+	}
+
+	err = cfg.DbQueries.EnableUserTOTP(r.Context(), jwtUserId)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error enabling totp: %s", err))
+		return
+	}
+
+	cfg.writeRecoveryCodes(w, r, jwtUserId)
+}
+
+func (cfg *ApiConfig) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	req := totpCodeRequest{}
+	err := decoder.Decode(&req)
+	if err != nil {
+		handleRequestErrors(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	jwtUserId := currentUserId(r)
+
+	totp, err := cfg.DbQueries.GetUserTOTP(r.Context(), jwtUserId)
+	if err != nil && err != sql.ErrNoRows {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting totp: %s", err))
+		return
+	}
+
+	if err == sql.ErrNoRows || !totp.EnabledAt.Valid {
+		handleRequestErrors(w, "two-factor authentication is not enabled", http.StatusNotFound)
+		return
+	}
+
+	ok, err := cfg.useTOTPCode(r.Context(), totp, req.Code)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error checking totp code: %s", err))
+		return
+	}
+
+	if !ok {
+		handleRequestErrors(w, "invalid code", http.StatusForbidden)
+		return
+	}
+
+	cfg.writeRecoveryCodes(w, r, jwtUserId)
+}
+
+// DisableTOTP accepts either an authenticator code or a recovery code, so a
+// user who lost their device can still turn 2FA off.
+func (cfg *ApiConfig) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	req := totpCodeRequest{}
+	err := decoder.Decode(&req)
+	if err != nil {
+		handleRequestErrors(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	jwtUserId := currentUserId(r)
+
+	totp, err := cfg.DbQueries.GetUserTOTP(r.Context(), jwtUserId)
+	if err != nil && err != sql.ErrNoRows {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting totp: %s", err))
+		return
+	}
+
+	if err == sql.ErrNoRows || !totp.EnabledAt.Valid {
+		handleRequestErrors(w, "two-factor authentication is not enabled", http.StatusNotFound)
+		return
+	}
+
+	ok, err := cfg.checkSecondFactor(r.Context(), totp, req.Code)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error checking second factor: %s", err))
+		return
+	}
+
+	if !ok {
+		handleRequestErrors(w, "invalid code", http.StatusForbidden)
+		return
+	}
+
+	err = cfg.DbQueries.DeleteRecoveryCodes(r.Context(), jwtUserId)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error deleting recovery codes: %s", err))
+		return
+	}
+
+	err = cfg.DbQueries.DeleteUserTOTP(r.Context(), jwtUserId)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error deleting totp: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LoginMFA finishes a login that Login paused with a challenge.
+func (cfg *ApiConfig) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	req := mfaLoginRequest{}
+	err := decoder.Decode(&req)
+	if err != nil {
+		handleRequestErrors(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if req.Challenge == "" || req.Code == "" {
+		handleRequestErrors(w, "challenge and code are required", http.StatusBadRequest)
+		return
+	}
+
+	challengeHash := auth.HashToken(req.Challenge)
+	challenge, err := cfg.DbQueries.GetMFAChallenge(r.Context(), challengeHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting mfa challenge: %s", err))
+		return
+	}
+
+	if cfg.Clock.Now().After(challenge.ExpiresAt) {
+		cfg.deleteMFAChallenge(r.Context(), challengeHash)
+		handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	attempts, err := cfg.DbQueries.IncrementMFAChallengeAttempts(r.Context(), challengeHash)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error counting mfa attempts: %s", err))
+		return
+	}
+
+	if attempts > maxMFAAttempts {
+		cfg.deleteMFAChallenge(r.Context(), challengeHash)
+		handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := cfg.DbQueries.GetUser(r.Context(), challenge.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting user: %s", err))
+		return
+	}
+
+	retryAfter, err := cfg.loginRetryAfter(r.Context(), loginAccountKey(user.Email), cfg.clientIP(r))
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error checking login lockout: %s", err))
+		return
+	}
+
+	if retryAfter > 0 {
+		writeTooManyLoginAttempts(w, retryAfter)
+		return
+	}
+
+	totp, err := cfg.DbQueries.GetUserTOTP(r.Context(), challenge.UserID)
+	if err != nil && err != sql.ErrNoRows {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting totp: %s", err))
+		return
+	}
+
+	// 2FA was switched off after the challenge was issued.
+	if err == sql.ErrNoRows || !totp.EnabledAt.Valid {
+		cfg.deleteMFAChallenge(r.Context(), challengeHash)
+		handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ok, err := cfg.checkSecondFactor(r.Context(), totp, req.Code)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error checking second factor: %s", err))
+		return
+	}
+
+	// Wrong codes count against the account like wrong passwords, otherwise
+	// each fresh challenge would reset the guessing budget.
+	if !ok {
+		cfg.recordLoginFailure(r.Context(), loginAccountKey(user.Email), cfg.clientIP(r))
+		handleRequestErrors(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	cfg.deleteMFAChallenge(r.Context(), challengeHash)
+
+	cfg.completeLogin(w, r, user)
+}
+
+// startMFAChallenge answers a correct password with a one-off challenge
+// instead of tokens. Only its hash is stored.
+func (cfg *ApiConfig) startMFAChallenge(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	challenge, err := auth.MakeRefreshToken()
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error generating mfa challenge: %s", err))
+		return
+	}
+
+	expiresAt := cfg.Clock.Now().Add(mfaChallengeTTL)
+	err = cfg.DbQueries.CreateMFAChallenge(r.Context(), database.CreateMFAChallengeParams{
+		TokenHash: auth.HashToken(challenge),
+		UserID:    userId,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error storing mfa challenge: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	res, err := json.Marshal(mfaChallengeResponse{
+		MFARequired: true,
+		Challenge:   challenge,
+		ExpiresAt:   expiresAt.Format(time.RFC3339),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
+
+func (cfg *ApiConfig) deleteMFAChallenge(ctx context.Context, tokenHash string) {
+	err := cfg.DbQueries.DeleteMFAChallenge(ctx, tokenHash)
+	if err != nil {
+		fmt.Println(fmt.Errorf("error deleting mfa challenge: %s", err))
+	}
+}
+
+// checkSecondFactor accepts an authenticator code or an unused recovery code.
+// Either one is consumed on success.
+func (cfg *ApiConfig) checkSecondFactor(ctx context.Context, totp database.UserTotp, code string) (bool, error) {
+	ok, err := cfg.useTOTPCode(ctx, totp, code)
+	if err != nil || ok {
+		return ok, err
+	}
+
+	used, err := cfg.DbQueries.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+		UserID:   totp.UserID,
+		CodeHash: auth.HashToken(strings.ToLower(strings.TrimSpace(code))),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return used == 1, nil
+}
+
+// useTOTPCode validates an authenticator code and records its time step, so
+// the same code cannot be replayed while it is still inside the window.
+func (cfg *ApiConfig) useTOTPCode(ctx context.Context, totp database.UserTotp, code string) (bool, error) {
+	step, ok := auth.ValidateTOTP(totp.Secret, strings.TrimSpace(code), cfg.Clock.Now())
+	if !ok {
+		return false, nil
+	}
+
+	used, err := cfg.DbQueries.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		UserID:       totp.UserID,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return used == 1, nil
+}
+
+// writeRecoveryCodes replaces any existing recovery codes with a fresh set and
+// returns them in plain text. Only their hashes are kept.
+func (cfg *ApiConfig) writeRecoveryCodes(w http.ResponseWriter, r *http.Request, userId uuid.UUID) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error generating recovery codes: %s", err))
+		return
+	}
+
+	err = cfg.DbQueries.DeleteRecoveryCodes(r.Context(), userId)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error deleting recovery codes: %s", err))
+		return
+	}
+
+	for _, code := range codes {
+		err = cfg.DbQueries.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			UserID:   userId,
+			CodeHash: auth.HashToken(code),
+		})
+		if err != nil {
+			handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+			fmt.Println(fmt.Errorf("error storing recovery code: %s", err))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	res, err := json.Marshal(recoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FerMusicComposer/chirpy/internal/auth"
+	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+var queryNamePattern = regexp.MustCompile(`^-- name: (\w+)`)
+
+// fakeDB answers sqlc queries by name with canned rows, so handlers can run
+// without Postgres. It records every query it sees, and any query without an
+// answer fails.
+type fakeDB struct {
+	rows    map[string][][]driver.Value
+	queries []string
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) {
+	return fakeConn{db}, nil
+}
+
+func (db *fakeDB) Driver() driver.Driver {
+	return nil
+}
+
+func (db *fakeDB) answer(query string) ([][]driver.Value, error) {
+	name := queryNamePattern.FindStringSubmatch(query)[1]
+	db.queries = append(db.queries, name)
+
+	rows, ok := db.rows[name]
+	if !ok {
+		return nil, errors.New("unexpected query " + name)
+	}
+	return rows, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c fakeConn) Close() error {
+	return nil
+}
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.db.answer(query)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: rows}, nil
+}
+
+func (c fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	rows, err := c.db.answer(query)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(rows)), nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestLoginMFAChallengeExpiry(t *testing.T) {
+	testCases := []struct {
+		name    string
+		elapsed time.Duration
+		expired bool
+	}{
+		{
+			name:    "within the challenge lifetime",
+			elapsed: mfaChallengeTTL - time.Second,
+			expired: false,
+		},
+		{
+			name:    "past the challenge lifetime",
+			elapsed: mfaChallengeTTL + time.Second,
+			expired: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+			challenge := "challenge"
+			db := &fakeDB{rows: map[string][][]driver.Value{
+				"GetMFAChallenge": {{
+					auth.HashToken(challenge),
+					clock.now,
+					uuid.New().String(),
+					clock.now.Add(mfaChallengeTTL),
+					int64(0),
+				}},
+				"DeleteMFAChallenge": {},
+				// Past the limit, so a live challenge stops right after the
+				// expiry check without needing a user.
+				"IncrementMFAChallengeAttempts": {{int64(maxMFAAttempts + 1)}},
+			}}
+			cfg := &ApiConfig{
+				DbQueries: database.New(sql.OpenDB(db)),
+				Clock:     clock,
+			}
+
+			clock.Advance(tc.elapsed)
+
+			body := `{"challenge": "` + challenge + `", "code": "123456"}`
+			req := httptest.NewRequest(http.MethodPost, "/api/login/mfa", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			cfg.LoginMFA(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+			}
+
+			counted := slices.Contains(db.queries, "IncrementMFAChallengeAttempts")
+			if counted == tc.expired {
+				t.Errorf("expected attempt counted to be %v, queries were %v", !tc.expired, db.queries)
+			}
+
+			if !slices.Contains(db.queries, "DeleteMFAChallenge") {
+				t.Errorf("expected the challenge to be deleted, queries were %v", db.queries)
+			}
+		})
+	}
+}
@@ -1,22 +1,51 @@
 package handlers
 
 import (
+	"net/netip"
 	"sync/atomic"
 
+	"github.com/FerMusicComposer/chirpy/internal/auth"
 	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/FerMusicComposer/chirpy/internal/mailer"
 )
 
 type ApiConfig struct {
 	FileServerHits atomic.Int32
+	PwdRehashes    atomic.Int64
 	DbQueries      *database.Queries
 	Environment    string
-	JWTSecret      string
+	JWTKeys        *auth.KeySet
+	Passwords      *auth.PasswordHasher
+	PasswordPolicy auth.PasswordPolicy
 	PolkaKey       string
+	Clock          auth.Clock
+	Mailer         mailer.Mailer
+	EmailLinks     EmailLinks
+	// TrustedProxies are the load balancers allowed to tell us the client's
+	// address in X-Forwarded-For.
+	TrustedProxies []netip.Prefix
+}
+
+// EmailLinks are the client pages that links in emails open. Each page gets
+// the token as a "token" query parameter and posts it back to the API.
+type EmailLinks struct {
+	ResetPassword string
+	VerifyEmail   string
+	MagicLogin    string
 }
 
 type response struct {
-	Error       *string `json:"error,omitempty"`
-	CleanedBody *string `json:"cleaned_body,omitempty"`
+	Error       *string      `json:"error,omitempty"`
+	CleanedBody *string      `json:"cleaned_body,omitempty"`
+	Fields      []fieldError `json:"fields,omitempty"`
+}
+
+// fieldError is one problem with one request field. Code is stable for
+// clients to match on.
+type fieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
 type baseModel struct {
@@ -32,13 +61,36 @@ type userCredentials struct {
 
 type userData struct {
 	baseModel
-	Email       string `json:"email"`
+	Email         string `json:"email"`
+	Handle        string `json:"handle"`
+	DisplayName   string `json:"display_name"`
+	Bio           string `json:"bio"`
+	AvatarURL     string `json:"avatar_url"`
+	IsChirpyRed   bool   `json:"is_chirpy_red"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+type profileFields struct {
+	Handle      *string `json:"handle"`
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+type profileResponse struct {
+	ID          string `json:"id"`
+	CreatedAt   string `json:"created_at"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	AvatarURL   string `json:"avatar_url"`
 	IsChirpyRed bool   `json:"is_chirpy_red"`
 }
 
 type chirpData struct {
-	Body   string `json:"body"`
-	UserID string `json:"user_id"`
+	Body      string `json:"body"`
+	UserID    string `json:"user_id"`
+	InReplyTo string `json:"in_reply_to,omitempty"`
 }
 
 type eventData struct {
@@ -49,22 +101,99 @@ type loginRequest struct {
 	userCredentials
 }
 
+type accountDeletionResponse struct {
+	DeletedAt string `json:"deleted_at"`
+	PurgeAt   string `json:"purge_at"`
+}
+
 type loginResponse struct {
 	userData
 	Token        string `json:"token"`
 	RefreshToken string `json:"refresh_token"`
 }
 
-type refreshTokenResponse struct {
+type magicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+// magicLinkResponse carries the nonce the client must send back with the
+// token from the email.
+type magicLinkResponse struct {
+	Nonce     string `json:"nonce"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+type redeemMagicLinkRequest struct {
+	Token string `json:"token"`
+	Nonce string `json:"nonce"`
+}
+
+// mfaChallengeResponse replaces loginResponse when the user has 2FA enabled.
+type mfaChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	Challenge   string `json:"challenge"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+type mfaLoginRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+type totpCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type totpEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type verifyEmailRequest struct {
 	Token string `json:"token"`
 }
 
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// passwordMetricsResponse counts accounts by whether their hash uses the
+// current Argon2id parameters.
+type passwordMetricsResponse struct {
+	Current  int64 `json:"current"`
+	Outdated int64 `json:"outdated"`
+	Unset    int64 `json:"unset"`
+	Rehashed int64 `json:"rehashed_since_start"`
+}
+
+type refreshTokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
 type createUserRequest struct {
 	userCredentials
+	Handle string `json:"handle"`
 }
 
 type updateUserRequest struct {
-	userCredentials
+	Email    *string `json:"email"`
+	Password *string `json:"password"`
+	profileFields
+}
+
+type patchUserRequest struct {
+	updateUserRequest
+	CurrentPassword string `json:"current_password"`
 }
 
 type createUserResponse struct {
@@ -73,11 +202,94 @@ type createUserResponse struct {
 
 type createChirpRequest struct {
 	chirpData
+	QuotedChirpID string `json:"quoted_chirp_id"`
 }
 
 type createChirpResponse struct {
 	baseModel
 	chirpData
+	LikeCount       int32                `json:"like_count"`
+	LikedByMe       bool                 `json:"liked_by_me"`
+	Kind            string               `json:"kind"`
+	Original        *createChirpResponse `json:"original,omitempty"`
+	OriginalDeleted bool                 `json:"original_deleted,omitempty"`
+	Edited          bool                 `json:"edited"`
+	Mentions        []mentionEntity      `json:"mentions"`
+}
+
+type mentionEntity struct {
+	UserID string `json:"user_id"`
+	Handle string `json:"handle"`
+	Start  int32  `json:"start"`
+	End    int32  `json:"end"`
+}
+
+type searchChirpResponse struct {
+	createChirpResponse
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+type updateChirpRequest struct {
+	Body string `json:"body"`
+}
+
+type chirpRevisionResponse struct {
+	ID        string `json:"id"`
+	Body      string `json:"body"`
+	CreatedAt string `json:"created_at"`
+}
+
+type chirpThreadResponse struct {
+	Ancestors   []createChirpResponse `json:"ancestors"`
+	Chirp       createChirpResponse   `json:"chirp"`
+	Descendants []createChirpResponse `json:"descendants"`
+}
+
+type trendingHashtagResponse struct {
+	Tag  string `json:"tag"`
+	Uses int64  `json:"uses"`
+}
+
+type notificationResponse struct {
+	ID        string `json:"id"`
+	CreatedAt string `json:"created_at"`
+	Kind      string `json:"kind"`
+	ActorID   string `json:"actor_id"`
+	ChirpID   string `json:"chirp_id,omitempty"`
+	Read      bool   `json:"read"`
+}
+
+type sessionResponse struct {
+	ID         string `json:"id"`
+	SignedInAt string `json:"signed_in_at"`
+	LastUsedAt string `json:"last_used_at"`
+	ExpiresAt  string `json:"expires_at"`
+	UserAgent  string `json:"user_agent"`
+	IPAddress  string `json:"ip_address"`
+}
+
+type createTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// personalAccessTokenResponse only carries Token in the response to the
+// request that created it.
+type personalAccessTokenResponse struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"created_at"`
+	ExpiresAt  string   `json:"expires_at"`
+	LastUsedAt *string  `json:"last_used_at"`
+	Token      string   `json:"token,omitempty"`
+}
+
+type followResponse struct {
+	UserID     string `json:"user_id"`
+	FollowedAt string `json:"followed_at"`
 }
 
 type webhookRequest struct {
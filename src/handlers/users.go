@@ -1,12 +1,12 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
 
-	"github.com/FerMusicComposer/chirpy/internal/auth"
 	"github.com/FerMusicComposer/chirpy/internal/database"
 )
 
@@ -19,22 +19,43 @@ func (cfg *ApiConfig) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fields := []fieldError{}
 	if req.Email == "" {
-		handleRequestErrors(w, "email is required", http.StatusBadRequest)
-		return
+		fields = append(fields, fieldError{Field: "email", Code: "required", Message: "email is required"})
+	} else if !validateEmail(req.Email) {
+		fields = append(fields, fieldError{Field: "email", Code: "invalid", Message: "email is invalid"})
 	}
 
-	if !validateEmail(req.Email) {
-		handleRequestErrors(w, "email is invalid", http.StatusBadRequest)
-		return
+	if req.Handle != "" && !validateHandle(req.Handle) {
+		fields = append(fields, fieldError{
+			Field:   "handle",
+			Code:    "invalid",
+			Message: fmt.Sprintf("handle must be %d-%d letters, digits or underscores", minHandleLength, maxHandleLength),
+		})
 	}
 
 	if req.Password == "" {
-		handleRequestErrors(w, "password is required", http.StatusBadRequest)
+		fields = append(fields, fieldError{Field: "password", Code: "required", Message: "password is required"})
+	} else {
+		passwordFields, err := cfg.checkPassword(req.Password, req.Email, req.Handle)
+		if err != nil {
+			handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+			fmt.Println(fmt.Errorf("error checking password policy: %s", err))
+			return
+		}
+		fields = append(fields, passwordFields...)
+	}
+
+	if len(fields) > 0 {
+		handleValidationErrors(w, fields)
 		return
 	}
 
-	hashedPwd, err := auth.HashPassword(req.Password)
+	if req.Handle == "" {
+		req.Handle = generateHandle()
+	}
+
+	hashedPwd, err := cfg.Passwords.Hash(req.Password)
 	if err != nil {
 		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
 		fmt.Println(fmt.Errorf("error hashing password: %s", err))
@@ -44,27 +65,30 @@ func (cfg *ApiConfig) CreateUser(w http.ResponseWriter, r *http.Request) {
 	user, err := cfg.DbQueries.CreateUser(r.Context(), database.CreateUserParams{
 		Email:          req.Email,
 		HashedPassword: hashedPwd,
+		Handle:         req.Handle,
 	})
 	if err != nil {
+		if isUniqueViolation(err) {
+			handleRequestErrors(w, "email or handle already taken", http.StatusConflict)
+			return
+		}
+
 		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
 		fmt.Println(fmt.Errorf("error creating user: %s", err))
 		return
 	}
 
+	err = cfg.sendEmailVerification(r.Context(), user)
+	if err != nil {
+		fmt.Println(fmt.Errorf("error sending email verification: %s", err))
+	}
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.WriteHeader(http.StatusCreated)
 
 	res, err := json.Marshal(createUserResponse{
-		userData: userData{
-			baseModel: baseModel{
-				ID:        user.ID.String(),
-				CreatedAt: user.CreatedAt.Format(time.RFC3339),
-				UpdatedAt: user.UpdatedAt.Format(time.RFC3339),
-			},
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+		userData: newUserData(user),
 	})
 	if err != nil {
 		handleRequestErrors(w, "error marshalling JSON", http.StatusInternalServerError)
@@ -74,75 +98,187 @@ func (cfg *ApiConfig) CreateUser(w http.ResponseWriter, r *http.Request) {
 	w.Write(res)
 }
 
+// UpdateUser is the original PUT form of PatchCurrentUser, kept for existing
+// clients and deprecated in favour of PATCH /api/users/me. It does not ask for
+// current_password, which PUT never did.
 func (cfg *ApiConfig) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", `</api/users/me>; rel="successor-version"`)
+	cfg.updateCurrentUser(w, r, false)
+}
+
+func (cfg *ApiConfig) PatchCurrentUser(w http.ResponseWriter, r *http.Request) {
+	cfg.updateCurrentUser(w, r, true)
+}
+
+// updateCurrentUser changes only the fields present in the request. Unless
+// the caller is the deprecated PUT, changing the email or password needs the
+// current password. A new password logs out every other session by revoking
+// all refresh tokens outside the session of the access token used.
+func (cfg *ApiConfig) updateCurrentUser(w http.ResponseWriter, r *http.Request, requireCurrentPassword bool) {
 	decoder := json.NewDecoder(r.Body)
-	var req updateUserRequest
+	var req patchUserRequest
 	err := decoder.Decode(&req)
 	if err != nil {
 		handleRequestErrors(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
-	if req.Email == "" {
-		handleRequestErrors(w, "email is required", http.StatusBadRequest)
-		return
-	}
-
-	if !validateEmail(req.Email) {
+	if req.Email != nil && !validateEmail(*req.Email) {
 		handleRequestErrors(w, "email is invalid", http.StatusBadRequest)
 		return
 	}
 
-	if req.Password == "" {
-		handleRequestErrors(w, "password is required", http.StatusBadRequest)
-		return
-	}
-
-	token, err := auth.GetBearerToken(r.Header)
+	err = validateProfile(req.profileFields)
 	if err != nil {
-		handleRequestErrors(w, err.Error(), http.StatusUnauthorized)
-		fmt.Println(fmt.Errorf("error obtaining bearer: %s", err))
+		handleRequestErrors(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	jwtUserId, err := auth.ValidateJWT(token, cfg.JWTSecret)
-	if err != nil {
-		handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
-		fmt.Println(fmt.Errorf("error validating jwt: %s", err))
-		return
+	jwtUserId := currentUserId(r)
+
+	if req.Email != nil || req.Password != nil {
+		if requireCurrentPassword && req.CurrentPassword == "" {
+			handleRequestErrors(w, "current_password is required to change email or password", http.StatusBadRequest)
+			return
+		}
+
+		user, err := cfg.DbQueries.GetUser(r.Context(), jwtUserId)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				handleRequestErrors(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+			fmt.Println(fmt.Errorf("error getting user: %s", err))
+			return
+		}
+
+		if requireCurrentPassword {
+			matched, err := cfg.Passwords.Check(req.CurrentPassword, user.HashedPassword)
+			if err != nil {
+				handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+				fmt.Println(fmt.Errorf("error checking password: %s", err))
+				return
+			}
+
+			if !matched {
+				handleRequestErrors(w, "current password is incorrect", http.StatusForbidden)
+				return
+			}
+		}
+
+		if req.Password != nil {
+			fields, err := cfg.checkPassword(*req.Password, passwordContext(user, req.updateUserRequest)...)
+			if err != nil {
+				handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+				fmt.Println(fmt.Errorf("error checking password policy: %s", err))
+				return
+			}
+
+			if len(fields) > 0 {
+				handleValidationErrors(w, fields)
+				return
+			}
+		}
 	}
 
-	hashedPwd, err := auth.HashPassword(req.Password)
-	if err != nil {
-		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
-		fmt.Println(fmt.Errorf("error hashing password: %s", err))
-		return
+	hashedPwd := sql.NullString{}
+	if req.Password != nil {
+		hashedPwd.String, err = cfg.Passwords.Hash(*req.Password)
+		if err != nil {
+			handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+			fmt.Println(fmt.Errorf("error hashing password: %s", err))
+			return
+		}
+		hashedPwd.Valid = true
 	}
+
 	user, err := cfg.DbQueries.UpdateUser(r.Context(), database.UpdateUserParams{
 		ID:             jwtUserId,
-		Email:          req.Email,
+		Email:          nullString(req.Email),
 		HashedPassword: hashedPwd,
+		Handle:         nullString(req.Handle),
+		DisplayName:    nullString(req.DisplayName),
+		Bio:            nullString(req.Bio),
+		AvatarUrl:      nullString(req.AvatarURL),
 	})
 	if err != nil {
+		if isUniqueViolation(err) {
+			handleRequestErrors(w, "email or handle already taken", http.StatusConflict)
+			return
+		}
+
 		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
 		fmt.Println(fmt.Errorf("error updating user: %s", err))
 		return
 	}
 
+	// The query clears email_verified_at when the email changes, so the new
+	// address gets its own link.
+	if req.Email != nil && !user.EmailVerifiedAt.Valid {
+		err = cfg.sendEmailVerification(r.Context(), user)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error sending email verification: %s", err))
+		}
+	}
+
+	// Without a session, as with a token issued before sessions were
+	// recorded in it, every session is signed out.
+	if req.Password != nil {
+		err = cfg.DbQueries.RevokeOtherUserSessions(r.Context(), database.RevokeOtherUserSessionsParams{
+			UserID:   jwtUserId,
+			FamilyID: currentSessionId(r).UUID,
+		})
+		if err != nil {
+			handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+			fmt.Println(fmt.Errorf("error revoking refresh tokens: %s", err))
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.WriteHeader(http.StatusOK)
 
 	res, err := json.Marshal(createUserResponse{
-		userData: userData{
-			baseModel: baseModel{
-				ID:        user.ID.String(),
-				CreatedAt: user.CreatedAt.Format(time.RFC3339),
-				UpdatedAt: user.UpdatedAt.Format(time.RFC3339),
-			},
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+		userData: newUserData(user),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
+
+// GetProfile is the public view of a user. It must never include the email.
+func (cfg *ApiConfig) GetProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.DbQueries.GetUserByHandle(r.Context(), r.PathValue("handle"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting user: %s", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	res, err := json.Marshal(profileResponse{
+		ID:          user.ID.String(),
+		CreatedAt:   user.CreatedAt.Format(time.RFC3339),
+		Handle:      user.Handle,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarUrl,
+		IsChirpyRed: user.IsChirpyRed,
 	})
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -151,3 +287,20 @@ func (cfg *ApiConfig) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Write(res)
 }
+
+func newUserData(user database.User) userData {
+	return userData{
+		baseModel: baseModel{
+			ID:        user.ID.String(),
+			CreatedAt: user.CreatedAt.Format(time.RFC3339),
+			UpdatedAt: user.UpdatedAt.Format(time.RFC3339),
+		},
+		Email:         user.Email,
+		Handle:        user.Handle,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		AvatarURL:     user.AvatarUrl,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	}
+}
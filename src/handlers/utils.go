@@ -1,11 +1,24 @@
 package handlers
 
 import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"regexp"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
 )
 
 func handleRequestErrors(w http.ResponseWriter, errMsg string, status int) {
@@ -21,6 +34,22 @@ func handleRequestErrors(w http.ResponseWriter, errMsg string, status int) {
 	w.Write(res)
 }
 
+// handleValidationErrors reports every field that failed at once, so a form
+// can show them all.
+func handleValidationErrors(w http.ResponseWriter, fields []fieldError) {
+	errMsg := "validation failed"
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusBadRequest)
+	res, err := json.Marshal(response{Error: &errMsg, Fields: fields})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	w.Write(res)
+}
+
 func cleanChirp(msg string) string {
 	badWords := map[string]struct{}{
 		"kerfuffle": {},
@@ -40,6 +69,232 @@ func cleanChirp(msg string) string {
 	return strings.Join(msgWords, " ")
 }
 
+const (
+	maxHashtagLength = 64
+	minHandleLength  = 3
+	maxHandleLength  = 30
+)
+
+// entitySpan is a #tag or @handle found in a chirp body. Start and End are
+// offsets in Unicode code points, End exclusive, and include the sigil.
+type entitySpan struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// scanEntities finds every run of isPart runes that follows sigil. The sigil
+// has to start the body or follow a rune that can't be part of the entity, so
+// neither "a#b" nor "me@example.com" match.
+func scanEntities(body string, sigil rune, isPart func(rune) bool) []entitySpan {
+	spans := []entitySpan{}
+
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != sigil || (i > 0 && isPart(runes[i-1])) {
+			continue
+		}
+
+		j := i + 1
+		for j < len(runes) && isPart(runes[j]) {
+			j++
+		}
+
+		if j > i+1 {
+			spans = append(spans, entitySpan{Text: string(runes[i+1 : j]), Start: i, End: j})
+		}
+		i = j - 1
+	}
+
+	return spans
+}
+
+// extractHashtags returns the distinct, lowercased #tags in a chirp body in
+// the order they first appear.
+func extractHashtags(body string) []string {
+	tags := []string{}
+	seen := map[string]struct{}{}
+
+	for _, span := range scanEntities(body, '#', isHashtagRune) {
+		tag := strings.ToLower(span.Text)
+		if len(tag) > maxHashtagLength {
+			continue
+		}
+		if _, found := seen[tag]; found {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// extractMentions returns every @handle in a chirp body with its position.
+// Handles are matched case-insensitively, so callers should compare them
+// lowercased.
+func extractMentions(body string) []entitySpan {
+	mentions := []entitySpan{}
+	for _, span := range scanEntities(body, '@', isHandleRune) {
+		if len(span.Text) < minHandleLength || len(span.Text) > maxHandleLength {
+			continue
+		}
+		mentions = append(mentions, span)
+	}
+	return mentions
+}
+
+func isHashtagRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isHandleRune(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+func validateHandle(handle string) bool {
+	if len(handle) < minHandleLength || len(handle) > maxHandleLength {
+		return false
+	}
+	for _, r := range handle {
+		if !isHandleRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// generateHandle is used for accounts created without a handle. Users can pick
+// a proper one later.
+func generateHandle() string {
+	key := make([]byte, 6)
+	rand.Read(key)
+	return "user_" + hex.EncodeToString(key)
+}
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxAvatarURLLength   = 2048
+)
+
+func validateProfile(p profileFields) error {
+	if p.Handle != nil && !validateHandle(*p.Handle) {
+		return fmt.Errorf("handle must be %d-%d letters, digits or underscores", minHandleLength, maxHandleLength)
+	}
+
+	if p.DisplayName != nil && utf8.RuneCountInString(*p.DisplayName) > maxDisplayNameLength {
+		return fmt.Errorf("display_name cannot be longer than %d characters", maxDisplayNameLength)
+	}
+
+	if p.Bio != nil && utf8.RuneCountInString(*p.Bio) > maxBioLength {
+		return fmt.Errorf("bio cannot be longer than %d characters", maxBioLength)
+	}
+
+	// An empty avatar_url clears the avatar.
+	if p.AvatarURL != nil && *p.AvatarURL != "" {
+		u, err := url.Parse(*p.AvatarURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(*p.AvatarURL) > maxAvatarURLLength {
+			return errors.New("avatar_url must be an http or https URL")
+		}
+	}
+
+	return nil
+}
+
+// backgroundSendTimeout bounds the work sendInBackground does for a request
+// that has already been answered.
+const backgroundSendTimeout = time.Minute
+
+// sendInBackground runs send after the request that asked for it has been
+// answered. Endpoints that must not reveal whether an address has an account
+// use it, since the lookup and the mail would otherwise show up in their
+// response time. Failures can only be logged.
+func (cfg *ApiConfig) sendInBackground(what string, send func(ctx context.Context) error) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundSendTimeout)
+		defer cancel()
+
+		err := send(ctx)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error sending %s: %s", what, err))
+		}
+	}()
+}
+
+// emailLink is the link emailed for token: page, one of the EmailLinks, with
+// the token added to its query.
+func emailLink(page, token string) (string, error) {
+	u, err := url.Parse(page)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
+
+// clientIP is the address of the client that sent the request. Behind a load
+// balancer every peer is the balancer, so X-Forwarded-For is read, but only
+// when the peer is one of cfg.TrustedProxies, since anyone can set it. The
+// header is walked from the right, skipping further trusted proxies, and the
+// first address they didn't add is the client.
+func (cfg *ApiConfig) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !cfg.isTrustedProxy(peer) {
+		return host
+	}
+
+	hops := []string{}
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+
+		client = hop
+		if !cfg.isTrustedProxy(hop) {
+			break
+		}
+	}
+
+	return client.Unmap().String()
+}
+
+func (cfg *ApiConfig) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range cfg.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
 func validateEmail(email string) bool {
 	regex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 	return regex.MatchString(email)
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanEntities(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		sigil rune
+		want  []entitySpan
+	}{
+		{
+			name:  "offsets count code points, not bytes",
+			body:  "héllo 🐦 #café time",
+			sigil: '#',
+			want:  []entitySpan{{Text: "café", Start: 8, End: 13}},
+		},
+		{
+			name:  "sigil inside a word",
+			body:  "a#b",
+			sigil: '#',
+			want:  []entitySpan{},
+		},
+		{
+			name:  "bare sigil",
+			body:  "# and #",
+			sigil: '#',
+			want:  []entitySpan{},
+		},
+		{
+			name:  "doubled sigil",
+			body:  "##go",
+			sigil: '#',
+			want:  []entitySpan{{Text: "go", Start: 1, End: 4}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scanEntities(tt.body, tt.sigil, isHashtagRune)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scanEntities(%q) = %+v, want %+v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []entitySpan
+	}{
+		{
+			name: "several mentions",
+			body: "hi @alice and @bob_1!",
+			want: []entitySpan{
+				{Text: "alice", Start: 3, End: 9},
+				{Text: "bob_1", Start: 14, End: 20},
+			},
+		},
+		{
+			name: "offsets after non-ASCII text",
+			body: "héllo 🐦 @alice",
+			want: []entitySpan{{Text: "alice", Start: 8, End: 14}},
+		},
+		{
+			name: "handle ends at a non-ASCII letter",
+			body: "こんにちは@alice様",
+			want: []entitySpan{{Text: "alice", Start: 5, End: 11}},
+		},
+		{
+			name: "email address",
+			body: "write to me@example.com",
+			want: []entitySpan{},
+		},
+		{
+			name: "wrapped in punctuation",
+			body: "(@alice),",
+			want: []entitySpan{{Text: "alice", Start: 1, End: 7}},
+		},
+		{
+			name: "duplicates keep every position",
+			body: "@alice @Alice @alice",
+			want: []entitySpan{
+				{Text: "alice", Start: 0, End: 6},
+				{Text: "Alice", Start: 7, End: 13},
+				{Text: "alice", Start: 14, End: 20},
+			},
+		},
+		{
+			name: "shortest handle",
+			body: "@abc @ab",
+			want: []entitySpan{{Text: "abc", Start: 0, End: 4}},
+		},
+		{
+			name: "longest handle",
+			body: "@" + strings.Repeat("a", maxHandleLength) + " @" + strings.Repeat("b", maxHandleLength+1),
+			want: []entitySpan{{Text: strings.Repeat("a", maxHandleLength), Start: 0, End: maxHandleLength + 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractMentions(tt.body)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractMentions(%q) = %+v, want %+v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateHandle(t *testing.T) {
+	tests := []struct {
+		handle string
+		want   bool
+	}{
+		{handle: "Alice_99", want: true},
+		{handle: strings.Repeat("a", minHandleLength), want: true},
+		{handle: strings.Repeat("a", minHandleLength-1), want: false},
+		{handle: strings.Repeat("a", maxHandleLength), want: true},
+		{handle: strings.Repeat("a", maxHandleLength+1), want: false},
+		{handle: "", want: false},
+		{handle: "alice!", want: false},
+		{handle: "al ice", want: false},
+		{handle: "álice", want: false},
+	}
+
+	for _, tt := range tests {
+		got := validateHandle(tt.handle)
+		if got != tt.want {
+			t.Errorf("validateHandle(%q) = %v, want %v", tt.handle, got, tt.want)
+		}
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile profileFields
+		wantErr bool
+	}{
+		{name: "nothing to change", profile: profileFields{}},
+		{name: "valid handle", profile: profileFields{Handle: ptr("alice_99")}},
+		{name: "invalid handle", profile: profileFields{Handle: ptr("al")}, wantErr: true},
+		{name: "longest display name", profile: profileFields{DisplayName: ptr(strings.Repeat("é", maxDisplayNameLength))}},
+		{name: "display name too long", profile: profileFields{DisplayName: ptr(strings.Repeat("a", maxDisplayNameLength+1))}, wantErr: true},
+		{name: "longest bio", profile: profileFields{Bio: ptr(strings.Repeat("🐦", maxBioLength))}},
+		{name: "bio too long", profile: profileFields{Bio: ptr(strings.Repeat("a", maxBioLength+1))}, wantErr: true},
+		{name: "empty avatar clears it", profile: profileFields{AvatarURL: ptr("")}},
+		{name: "https avatar", profile: profileFields{AvatarURL: ptr("https://example.com/me.png")}},
+		{name: "javascript avatar", profile: profileFields{AvatarURL: ptr("javascript:alert(1)")}, wantErr: true},
+		{name: "ftp avatar", profile: profileFields{AvatarURL: ptr("ftp://example.com/me.png")}, wantErr: true},
+		{name: "avatar without host", profile: profileFields{AvatarURL: ptr("https:///me.png")}, wantErr: true},
+		{name: "avatar too long", profile: profileFields{AvatarURL: ptr("https://example.com/" + strings.Repeat("a", maxAvatarURLLength))}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateProfile(tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateHandle(t *testing.T) {
+	seen := map[string]struct{}{}
+	for range 100 {
+		handle := generateHandle()
+		if !strings.HasPrefix(handle, "user_") {
+			t.Errorf("generateHandle() = %q, want a user_ prefix", handle)
+		}
+		if !validateHandle(handle) {
+			t.Errorf("generateHandle() = %q, which validateHandle rejects", handle)
+		}
+		if _, found := seen[handle]; found {
+			t.Fatalf("generateHandle() returned %q twice", handle)
+		}
+		seen[handle] = struct{}{}
+	}
+}
+
+func TestEmailLink(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{
+			name: "page without a query",
+			page: "http://localhost:8080/app/reset-password.html",
+			want: "http://localhost:8080/app/reset-password.html?token=a%2Bb%2Fc",
+		},
+		{
+			name: "page with a query",
+			page: "https://example.com/account?flow=reset",
+			want: "https://example.com/account?flow=reset&token=a%2Bb%2Fc",
+		},
+		{
+			name: "page with a stale token",
+			page: "https://example.com/reset?token=old",
+			want: "https://example.com/reset?token=a%2Bb%2Fc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := emailLink(tt.page, "a+b/c")
+			if err != nil {
+				t.Fatalf("emailLink() returned an unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("emailLink(%q) = %q, want %q", tt.page, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	cfg := &ApiConfig{TrustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+	}}
+
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded []string
+		want      string
+	}{
+		{
+			name: "direct client",
+			peer: "203.0.113.7:5000",
+			want: "203.0.113.7",
+		},
+		{
+			name:      "forwarding header from an untrusted peer",
+			peer:      "203.0.113.7:5000",
+			forwarded: []string{"198.51.100.1"},
+			want:      "203.0.113.7",
+		},
+		{
+			name:      "client behind a trusted proxy",
+			peer:      "10.0.0.5:5000",
+			forwarded: []string{"198.51.100.1"},
+			want:      "198.51.100.1",
+		},
+		{
+			name:      "forged hops left of the client are ignored",
+			peer:      "10.0.0.5:5000",
+			forwarded: []string{"1.1.1.1, 198.51.100.1"},
+			want:      "198.51.100.1",
+		},
+		{
+			name:      "chain of trusted proxies",
+			peer:      "10.0.0.5:5000",
+			forwarded: []string{"198.51.100.1, 192.0.2.1", "10.1.2.3"},
+			want:      "198.51.100.1",
+		},
+		{
+			name: "trusted proxy without the header",
+			peer: "10.0.0.5:5000",
+			want: "10.0.0.5",
+		},
+		{
+			name:      "malformed hop",
+			peer:      "10.0.0.5:5000",
+			forwarded: []string{"198.51.100.1, not-an-ip"},
+			want:      "10.0.0.5",
+		},
+		{
+			name:      "IPv6 client",
+			peer:      "[::ffff:10.0.0.5]:5000",
+			forwarded: []string{"2001:db8::1"},
+			want:      "2001:db8::1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/login", nil)
+			r.RemoteAddr = tt.peer
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+
+			got := cfg.clientIP(r)
+			if got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
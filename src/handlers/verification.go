@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FerMusicComposer/chirpy/internal/auth"
+	"github.com/FerMusicComposer/chirpy/internal/database"
+	"github.com/FerMusicComposer/chirpy/internal/mailer"
+)
+
+const (
+	emailVerificationTTL = 24 * time.Hour
+	// emailVerificationCooldown is how long a user waits between resends.
+	emailVerificationCooldown = time.Minute
+)
+
+// sendEmailVerification mails a link that verifies the user's current email.
+// Earlier links stay valid, but only for the address they were sent to.
+func (cfg *ApiConfig) sendEmailVerification(ctx context.Context, user database.User) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	err = cfg.DbQueries.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: cfg.Clock.Now().Add(emailVerificationTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link, err := emailLink(cfg.EmailLinks.VerifyEmail, token)
+	if err != nil {
+		return err
+	}
+
+	return cfg.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email",
+		Body: fmt.Sprintf("Confirm this is your address to start chirping:\n%s\n\n"+
+			"The link works for 24 hours. If you didn't sign up for Chirpy, you can ignore this email.", link),
+	})
+}
+
+// VerifyEmail redeems a link from sendEmailVerification. It is not behind
+// RequireAuth since the link is often opened on another device.
+func (cfg *ApiConfig) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	req := verifyEmailRequest{}
+	err := decoder.Decode(&req)
+	if err != nil {
+		handleRequestErrors(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" {
+		handleRequestErrors(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := cfg.DbQueries.UseEmailVerificationToken(r.Context(), auth.HashToken(req.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			handleRequestErrors(w, "verification token is invalid or expired", http.StatusBadRequest)
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error using email verification token: %s", err))
+		return
+	}
+
+	// No rows means the email changed after the link was sent, or another
+	// link already verified it.
+	verified, err := cfg.DbQueries.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		ID:    token.UserID,
+		Email: token.Email,
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error verifying email: %s", err))
+		return
+	}
+
+	if verified == 0 {
+		handleRequestErrors(w, "verification token is invalid or expired", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *ApiConfig) ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.DbQueries.GetUser(r.Context(), currentUserId(r))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeUnauthorized(w, "")
+			return
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting user: %s", err))
+		return
+	}
+
+	if user.EmailVerifiedAt.Valid {
+		handleRequestErrors(w, "email is already verified", http.StatusConflict)
+		return
+	}
+
+	seconds, err := cfg.DbQueries.GetEmailVerificationRetryAfter(r.Context(), database.GetEmailVerificationRetryAfterParams{
+		CooldownSeconds: int32(emailVerificationCooldown / time.Second),
+		UserID:          user.ID,
+	})
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error checking email verification cooldown: %s", err))
+		return
+	}
+
+	if seconds > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(seconds)))
+		handleRequestErrors(w, "a verification email was sent recently, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	err = cfg.sendEmailVerification(r.Context(), user)
+	if err != nil {
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error sending email verification: %s", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// requireVerifiedEmail writes a 403 and returns false when the caller has not
+// verified their email yet. Every endpoint that posts, edits or amplifies
+// content, or notifies another user, goes through it.
+func (cfg *ApiConfig) requireVerifiedEmail(w http.ResponseWriter, r *http.Request) bool {
+	user, err := cfg.DbQueries.GetUser(r.Context(), currentUserId(r))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeUnauthorized(w, "")
+			return false
+		}
+
+		handleRequestErrors(w, "something went wrong", http.StatusInternalServerError)
+		fmt.Println(fmt.Errorf("error getting user: %s", err))
+		return false
+	}
+
+	if !user.EmailVerifiedAt.Valid {
+		handleRequestErrors(w, "verify your email first", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}